@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// The applink redirect type sends phones to the link's ios_url or
+// android_url (a custom scheme like myapp://item/42, or a universal/app link)
+// and falls back to long_url when the app doesn't open within
+// appLinkFallbackMs. Other devices go straight to long_url.
+const appLinkFallbackMs = 1500
+
+// unsafeAppSchemes can run code in the page instead of opening an app.
+var unsafeAppSchemes = map[string]bool{"javascript": true, "data": true, "vbscript": true, "file": true, "blob": true}
+
+// checkAppURL trims an ios_url or android_url and checks it is an absolute
+// URL with a scheme that opens an app or web page.
+func checkAppURL(name string, v *string) error {
+	if v == nil {
+		return nil
+	}
+	*v = strings.TrimSpace(*v)
+	if *v == "" {
+		return nil
+	}
+	if utf8.RuneCountInString(*v) > maxLongURLLen {
+		return fmt.Errorf("%s is longer than %d characters", name, maxLongURLLen)
+	}
+	u, err := url.Parse(*v)
+	if err != nil || u.Scheme == "" || unsafeAppSchemes[strings.ToLower(u.Scheme)] {
+		return fmt.Errorf("%s must be an app link such as myapp://path or https://…", name)
+	}
+	return nil
+}
+
+// checkAppLink reports whether an applink redirect has somewhere to send
+// phones; the other redirect types ignore the app URLs.
+func checkAppLink(redirectType, iosURL, androidURL string) error {
+	if redirectType == "applink" && iosURL == "" && androidURL == "" {
+		return errors.New("redirect_type applink needs ios_url or android_url")
+	}
+	return nil
+}
+
+var appLinkRedirectTmpl = template.Must(template.New("applink").Funcs(redirectTmplFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="UTF-8">
+<meta name="robots" content="noindex,nofollow">
+{{if .OGTitle}}<title>{{.OGTitle}}</title>
+<meta property="og:title" content="{{.OGTitle}}">
+<meta name="twitter:title" content="{{.OGTitle}}">{{end}}
+{{if .OGDescription}}<meta property="og:description" content="{{.OGDescription}}">
+<meta name="twitter:description" content="{{.OGDescription}}">{{end}}
+{{if .OGImage}}<meta property="og:image" content="{{.OGImage}}">
+<meta name="twitter:image" content="{{.OGImage}}">
+<meta name="twitter:card" content="summary_large_image">{{else}}<meta name="twitter:card" content="summary">{{end}}
+<meta property="og:type" content="website">
+<meta property="og:url" content="{{.ShortURL}}">
+<noscript><meta http-equiv="refresh" content="0; url={{.LongURL}}"></noscript>
+<style>:root{color-scheme:light dark}body{margin:0;min-height:100vh;display:flex;align-items:center;justify-content:center;background-color:Canvas;color:CanvasText;font-family:system-ui,sans-serif;font-size:.9rem}a{color:LinkText}</style>
+</head>
+<body><p>Opening the app… <a href="{{.LongURL}}">continue in the browser</a></p>
+<script>
+(function(){
+var ua=navigator.userAgent,web={{jsStr .LongURL}},app='';
+if(/iPhone|iPad|iPod/.test(ua)||(/Macintosh/.test(ua)&&navigator.maxTouchPoints>1))app={{jsStr .IOSURL}};
+else if(/Android/.test(ua))app={{jsStr .AndroidURL}};
+if(!app){window.location.replace(web);return;}
+// Leaving for the app hides the page; only fall back if we're still here.
+var t=setTimeout(function(){window.location.replace(web);},{{.FallbackMs}});
+document.addEventListener('visibilitychange',function(){if(document.hidden)clearTimeout(t);});
+window.location.href=app;
+})();
+</script>
+</body>
+</html>`))
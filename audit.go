@@ -0,0 +1,106 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// audit_log keeps who changed what on each link: creation (and import
+// overwrites), long_url edits, public/internal toggles, renames, deletion,
+// restores from the trash and purges. Entries follow a link through renames
+// and outlive its deletion. The actor is the client IP, or "cleanup" for
+// links removed by the expiry sweep or purged from the trash by it.
+const (
+	auditCreate   = "create"
+	auditLongURL  = "long_url"
+	auditPublic   = "public_enabled"
+	auditInternal = "internal_enabled"
+	auditRename   = "rename"
+	auditDelete   = "delete" // moved to the trash, or removed by the expiry sweep
+	auditRestore  = "restore"
+	auditPurge    = "purge"
+	auditImport   = "import" // an import with ?mode=overwrite replaced the link
+)
+
+type auditEntry struct {
+	Action    string `json:"action"`
+	OldValue  string `json:"old_value"`
+	NewValue  string `json:"new_value"`
+	Actor     string `json:"actor"`
+	ChangedAt string `json:"changed_at"`
+}
+
+// logAudit appends an entry for code. Callers inside a transaction pass it,
+// so the entry commits with the change.
+func logAudit(ex execer, code, action, oldValue, newValue, actor string) error {
+	_, err := ex.Exec(
+		"INSERT INTO audit_log (code, action, old_value, new_value, actor, changed_at) VALUES (?, ?, ?, ?, ?, ?)",
+		code, action, oldValue, newValue, actor, time.Now().UTC().Format(time.RFC3339),
+	)
+	return err
+}
+
+// logAuditBestEffort is logAudit for changes already committed without a
+// transaction: a failure is logged and the request goes ahead.
+func logAuditBestEffort(code, action, oldValue, newValue, actor string) {
+	if err := logAudit(db, code, action, oldValue, newValue, actor); err != nil {
+		log.Printf("audit %s %s: %v", code, action, err)
+	}
+}
+
+// auditPatch records the audited fields a PATCH changed on code.
+func auditPatch(ex execer, code string, before urlRecord, longURL *string, public, internal *bool, actor string) error {
+	if longURL != nil && *longURL != before.LongURL {
+		if err := logAudit(ex, code, auditLongURL, before.LongURL, *longURL, actor); err != nil {
+			return err
+		}
+	}
+	if public != nil && *public != before.PublicEnabled {
+		if err := logAudit(ex, code, auditPublic, strconv.FormatBool(before.PublicEnabled), strconv.FormatBool(*public), actor); err != nil {
+			return err
+		}
+	}
+	if internal != nil && *internal != before.InternalEnabled {
+		if err := logAudit(ex, code, auditInternal, strconv.FormatBool(before.InternalEnabled), strconv.FormatBool(*internal), actor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// urlsHistoryHandler serves GET /urls/{code}/history, newest first. The
+// history of a deleted link stays readable.
+func urlsHistoryHandler(w http.ResponseWriter, r *http.Request, code string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rows, err := db.Query("SELECT action, old_value, new_value, actor, changed_at FROM audit_log WHERE code = ? ORDER BY changed_at DESC, id DESC", code)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	defer rows.Close()
+	entries := []auditEntry{}
+	for rows.Next() {
+		var e auditEntry
+		if err := rows.Scan(&e.Action, &e.OldValue, &e.NewValue, &e.Actor, &e.ChangedAt); err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	if len(entries) == 0 {
+		if _, err := getRecord(code); err != nil {
+			jsonError(w, http.StatusNotFound, "not found")
+			return
+		}
+	}
+	writeJSON(w, r, http.StatusOK, entries)
+}
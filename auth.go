@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Admin login (see requireAdmin): when the admin_password setting is set,
+// the UI and the management API need a session cookie from POST /login, or
+// the password as HTTP Basic auth for scripts; the link endpoints also take
+// an API token (see tokens.go). Redirects and the public endpoints (/pass/,
+// /qr/, /embed/, /oembed, /hook/, /ogimg/, /og-image/, /preview/, /badge/)
+// stay open. The setting holds the password's bcrypt hash, never the
+// password itself.
+const sessionCookie = "gourl_session"
+
+// sessionKey signs session tokens. It is generated once and kept in the
+// settings table, so sessions survive restarts and work across instances.
+var sessionKey []byte
+
+// loginLimiter throttles POST /login, failed Basic auth and wrong
+// /admin/reset confirm tokens per client IP.
+var loginLimiter = newRateLimiter(10, time.Minute)
+
+// loadSessionKey reads the session signing key, creating it on first start.
+func loadSessionKey() error {
+	b := make([]byte, 32)
+	rand.Read(b)
+	// DO NOTHING: when several instances start at once, the first key wins.
+	if _, err := db.Exec("INSERT INTO settings (key, value) VALUES ('session_key', ?) ON CONFLICT (key) DO NOTHING", hex.EncodeToString(b)); err != nil {
+		return err
+	}
+	var key string
+	if err := db.QueryRow("SELECT value FROM settings WHERE key = 'session_key'").Scan(&key); err != nil {
+		return err
+	}
+	sessionKey = []byte(key)
+	return nil
+}
+
+func adminAuthEnabled() bool {
+	return cfg.setting("admin_password") != ""
+}
+
+// sessionMAC signs a token's expiry. Mixing in the password hash means
+// changing the password logs every session out.
+func sessionMAC(expiry string) string {
+	m := hmac.New(sha256.New, sessionKey)
+	m.Write([]byte(cfg.setting("admin_password")))
+	m.Write([]byte{0})
+	m.Write([]byte(expiry))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// setSessionCookie starts a session lasting sessionTTL.
+func setSessionCookie(w http.ResponseWriter, r *http.Request) {
+	exp := time.Now().Add(sessionTTL)
+	unix := strconv.FormatInt(exp.Unix(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    unix + "." + sessionMAC(unix),
+		Path:     "/",
+		Expires:  exp,
+		HttpOnly: true,
+		Secure:   requestScheme(r) == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func validSession(r *http.Request) bool {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+	unix, mac, ok := strings.Cut(c.Value, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(sessionMAC(unix))) {
+		return false
+	}
+	exp, err := strconv.ParseInt(unix, 10, 64)
+	return err == nil && time.Now().Unix() < exp
+}
+
+// adminPasswordOK compares a password against the admin_password hash. A
+// hash that is not bcrypt is the unsalted sha256 stored before bcrypt; it is
+// replaced once the password matches, which logs other sessions out once.
+// The last match is remembered so Basic auth scripts don't pay for bcrypt
+// on every request.
+func adminPasswordOK(pw string) bool {
+	want := cfg.setting("admin_password")
+	if want == "" {
+		return false
+	}
+	key := hashPassword(want + "\x00" + pw)
+	if last := lastAdminMatch.Load(); last != nil && subtle.ConstantTimeCompare([]byte(*last), []byte(key)) == 1 {
+		return true
+	}
+	legacy := !strings.HasPrefix(want, "$2")
+	algo := passwordAlgoBcrypt
+	if legacy {
+		algo = passwordAlgoSHA256
+	}
+	if !linkPasswordOK(want, algo, pw) {
+		return false
+	}
+	lastAdminMatch.Store(&key)
+	if legacy {
+		if h, err := hashLinkPassword(pw); err != nil {
+			log.Printf("upgrade admin password hash: %v", err)
+		} else if err := saveSetting("admin_password", h); err != nil {
+			log.Printf("upgrade admin password hash: %v", err)
+		} else {
+			cfg.setSettings(map[string]string{"admin_password": h})
+		}
+	}
+	return true
+}
+
+// lastAdminMatch is the hashPassword of the admin_password hash and the
+// password that last matched it.
+var lastAdminMatch atomic.Pointer[string]
+
+// envSecretHash returns a bcrypt hash of a settingSecret value from the env
+// or CONFIG_FILE. bcrypt salts every hash differently, and sessionMAC mixes
+// the hash in, so the hash is kept in the settings table under key+"_env_hash"
+// and reused while it still matches: restarts and other instances then keep
+// accepting the same sessions.
+func envSecretHash(key, pw string) (string, error) {
+	cacheKey := key + "_env_hash"
+	var cached string
+	err := db.QueryRow("SELECT value FROM settings WHERE key = ?", cacheKey).Scan(&cached)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if cached != "" && linkPasswordOK(cached, passwordAlgoBcrypt, pw) {
+		return cached, nil
+	}
+	h, err := hashLinkPassword(pw)
+	if err != nil {
+		return "", err
+	}
+	return h, saveSetting(cacheKey, h)
+}
+
+// requireAdmin reports whether r may use the UI or management API. If not,
+// it has answered: page loads are sent to the login form, everything else
+// gets a JSON 401. API tokens are accepted on apiTokenRoute paths only.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !adminAuthEnabled() || validSession(r) {
+		return true
+	}
+	if _, pw, ok := r.BasicAuth(); ok {
+		ip := clientIP(r)
+		if blocked, retry := loginLimiter.exceeded(ip); blocked {
+			backoffResponse(w, http.StatusTooManyRequests, "rate_limited", "too many failed logins", retry)
+			return false
+		}
+		if adminPasswordOK(pw) {
+			return true
+		}
+		loginLimiter.hit(ip)
+		log.Printf("basic auth: wrong password from %s", ip)
+	}
+	if token, ok := bearerToken(r); ok && apiTokenRoute(r) {
+		if validAPIToken(token) {
+			return true
+		}
+		log.Printf("api token: unknown token from %s", clientIP(r))
+		jsonError(w, http.StatusUnauthorized, "invalid API token")
+		return false
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return false
+	}
+	jsonError(w, http.StatusUnauthorized, "login required")
+	return false
+}
+
+var loginTmpl = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="UTF-8"><meta name="viewport" content="width=device-width, initial-scale=1"><meta name="robots" content="noindex,nofollow"><title>Sign in</title>
+<style>:root{color-scheme:light dark}body{margin:0;min-height:100vh;display:flex;align-items:center;justify-content:center;background-color:Canvas;color:CanvasText;font-family:system-ui,sans-serif;font-size:.9rem}form{display:flex;flex-direction:column;gap:.6rem;width:16rem}input,button{font:inherit;padding:.5rem .7rem}p{margin:0}.err{color:#f85149}</style>
+</head>
+<body><form method="post" action="/login">
+<label for="password">Admin password</label>
+<input type="password" id="password" name="password" autocomplete="current-password" autofocus required>
+{{if .}}<p class="err" role="alert">{{.}}</p>{{end}}
+<button type="submit">Sign in</button>
+</form></body>
+</html>`))
+
+func renderLogin(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	loginTmpl.Execute(w, msg)
+}
+
+// loginHandler serves GET /login (the form) and POST /login (form field
+// "password"), which sets the session cookie and returns to the UI.
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthEnabled() {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		renderLogin(w, http.StatusOK, "")
+	case http.MethodPost:
+		if !loginLimiter.limitRequest(w, r) {
+			return
+		}
+		if !adminPasswordOK(r.PostFormValue("password")) {
+			log.Printf("login: wrong password from %s", clientIP(r))
+			renderLogin(w, http.StatusUnauthorized, "Wrong password.")
+			return
+		}
+		loginLimiter.reset(clientIP(r))
+		setSessionCookie(w, r)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// logoutHandler serves POST /logout.
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1, HttpOnly: true})
+	w.WriteHeader(http.StatusNoContent)
+}
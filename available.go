@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// availableHandler serves GET /available/{code}: whether code could be used
+// as a custom alias right now. 400 for codes that fail validCode, so clients
+// can tell "invalid" from "taken"; otherwise {available, reason}, with reason
+// "not_allowed" (blockedCode) or "taken" (trashed links included).
+func availableHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	code := strings.TrimPrefix(r.URL.Path, "/available/")
+	if !validCode.MatchString(code) {
+		jsonError(w, http.StatusBadRequest, "code must be 1–32 chars: letters, numbers, hyphens, underscores")
+		return
+	}
+	resp := struct {
+		Code      string `json:"code"`
+		Available bool   `json:"available"`
+		Reason    string `json:"reason,omitempty"`
+	}{Code: code}
+	if blockedCode(code) {
+		resp.Reason = "not_allowed"
+	} else if taken, err := codeExists(code); err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	} else if taken {
+		resp.Reason = "taken"
+	} else {
+		resp.Available = true
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, http.StatusOK, resp)
+}
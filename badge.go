@@ -0,0 +1,86 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Badge colours, as on shields.io.
+const (
+	badgeGreen = "#4c1"
+	badgeRed   = "#e05d44"
+	badgeGrey  = "#9f9f9f"
+	badgeBlue  = "#007ec6"
+)
+
+// badgeSVG renders a flat two-part badge. Text width is estimated at a fixed
+// 7px per character of 11px Verdana, which is close enough for short labels.
+func badgeSVG(label, message, color string) []byte {
+	lw := 10 + 7*utf8.RuneCountInString(label)
+	mw := 10 + 7*utf8.RuneCountInString(message)
+	label, message = html.EscapeString(label), html.EscapeString(message)
+	return fmt.Appendf(nil, `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[3]s: %[4]s">`+
+		`<title>%[3]s: %[4]s</title>`+
+		`<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`+
+		`<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>`+
+		`<g clip-path="url(#r)"><rect width="%[2]d" height="20" fill="#555"/><rect x="%[2]d" width="%[6]d" height="20" fill="%[5]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>`+
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`+
+		`<text x="%[7]d" y="14">%[3]s</text><text x="%[8]d" y="14">%[4]s</text></g></svg>`,
+		lw+mw, lw, label, message, color, mw, lw/2, lw+mw/2)
+}
+
+// badgeHandler serves GET /badge/{code}.svg: the link's status (active,
+// expired, exhausted), or with ?show=clicks its click count. Like the embed
+// endpoints it only describes public links, and never shows clicks of
+// no_analytics links.
+func badgeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	code, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/badge/"), ".svg")
+	if !ok || !validCode.MatchString(code) {
+		http.NotFound(w, r)
+		return
+	}
+	show := r.URL.Query().Get("show")
+	if show != "" && show != "status" && show != "clicks" {
+		http.Error(w, "show must be status or clicks", http.StatusBadRequest)
+		return
+	}
+	row, err := getURLRow(code)
+	if err == sql.ErrNoRows || (err == nil && !row.PublicEnabled) || (err == nil && show == "clicks" && row.NoAnalytics) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var svg []byte
+	if show == "clicks" {
+		msg := strconv.Itoa(row.UseCount) + " clicks"
+		if row.UseCount == 1 {
+			msg = "1 click"
+		}
+		svg = badgeSVG(code, msg, badgeBlue)
+	} else {
+		gone, _ := linkExpiry(row.ExpiresAt)
+		switch {
+		case gone || row.IdleExpired:
+			svg = badgeSVG(code, "expired", badgeGrey)
+		case row.UsesExhausted:
+			svg = badgeSVG(code, "exhausted", badgeRed)
+		default:
+			svg = badgeSVG(code, "active", badgeGreen)
+		}
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(svg)
+}
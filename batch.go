@@ -0,0 +1,136 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maxBatchBytes caps a POST /urls/batch or /urls/tag body; batchMax codes
+// fit easily.
+const maxBatchBytes = 1 << 20
+
+// batchActions are the changes POST /urls/batch can apply to many links.
+var batchActions = map[string]bool{
+	"delete":           true,
+	"enable_public":    true,
+	"disable_public":   true,
+	"enable_internal":  true,
+	"disable_internal": true,
+}
+
+type batchResult struct {
+	Code            string `json:"code"`
+	PublicEnabled   bool   `json:"public_enabled"`
+	InternalEnabled bool   `json:"internal_enabled"`
+	Deleted         bool   `json:"deleted,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+// urlsBatchHandler serves POST /urls/batch: one action on many links in one
+// transaction. delete moves the links to the trash like DELETE /urls/{code}
+// (without its click confirmation). Unknown codes, and disables that would
+// leave a link with no enabled type, are reported per code and left alone.
+// At most batchMax codes per request.
+func urlsBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Codes  []string `json:"codes"`
+		Action string   `json:"action"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBytes)).Decode(&body); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if len(body.Codes) == 0 {
+		jsonError(w, http.StatusBadRequest, "codes is required")
+		return
+	}
+	if len(body.Codes) > batchMax {
+		jsonError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d codes per request", batchMax))
+		return
+	}
+	if !batchActions[body.Action] {
+		jsonError(w, http.StatusBadRequest, "action must be delete, enable_public, disable_public, enable_internal or disable_internal")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	defer tx.Rollback()
+
+	actor := clientIP(r)
+	results := make([]batchResult, 0, len(body.Codes))
+	var changed []string
+	for _, code := range body.Codes {
+		var before urlRecord
+		err := tx.QueryRow("SELECT long_url, public_enabled, internal_enabled FROM urls WHERE code = ? AND "+liveLink, code).
+			Scan(&before.LongURL, &before.PublicEnabled, &before.InternalEnabled)
+		if err == sql.ErrNoRows {
+			results = append(results, batchResult{Code: code, Error: "not found"})
+			continue
+		} else if err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		res := batchResult{Code: code, PublicEnabled: before.PublicEnabled, InternalEnabled: before.InternalEnabled}
+		if body.Action == "delete" {
+			if _, err := tx.Exec("UPDATE urls SET deleted_at = ? WHERE code = ?", time.Now().UTC().Format(time.RFC3339), code); err != nil {
+				jsonError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			if err := logAudit(tx, code, auditDelete, before.LongURL, "", actor); err != nil {
+				jsonError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			res.Deleted = true
+			results = append(results, res)
+			changed = append(changed, code)
+			continue
+		}
+
+		switch body.Action {
+		case "enable_public":
+			res.PublicEnabled = true
+		case "disable_public":
+			res.PublicEnabled = false
+		case "enable_internal":
+			res.InternalEnabled = true
+		case "disable_internal":
+			res.InternalEnabled = false
+		}
+		if !res.PublicEnabled && !res.InternalEnabled {
+			res.PublicEnabled, res.InternalEnabled = before.PublicEnabled, before.InternalEnabled
+			res.Error = "at least one link type (public_enabled or internal_enabled) must stay true"
+			results = append(results, res)
+			continue
+		}
+		if res.PublicEnabled != before.PublicEnabled || res.InternalEnabled != before.InternalEnabled {
+			if _, err := tx.Exec("UPDATE urls SET public_enabled = ?, internal_enabled = ? WHERE code = ?",
+				boolToInt(res.PublicEnabled), boolToInt(res.InternalEnabled), code); err != nil {
+				jsonError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			if err := auditPatch(tx, code, before, nil, &res.PublicEnabled, &res.InternalEnabled, actor); err != nil {
+				jsonError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			changed = append(changed, code)
+		}
+		results = append(results, res)
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	if len(changed) > 0 {
+		markChanged()
+		forgetRecord(changed...)
+	}
+
+	writeJSON(w, r, http.StatusOK, map[string]any{"results": results})
+}
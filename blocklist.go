@@ -0,0 +1,73 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// errHostNotAllowed marks a destination refused by the blocked_hosts or
+// allowed_hosts setting; handlers answer it with 403.
+var errHostNotAllowed = errors.New("destination host is not allowed")
+
+var validHostname = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+
+// normalizeHostList lowercases, trims and dedupes hostnames (a leading "*."
+// or "." is dropped; every entry matches subdomains anyway) and joins them
+// for storage. Blank entries are skipped.
+func normalizeHostList(in []string) (string, error) {
+	var out []string
+	for _, raw := range in {
+		h := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(raw)), "*."), ".")
+		if h == "" {
+			continue
+		}
+		if !validHostname.MatchString(h) {
+			return "", fmt.Errorf("invalid hostname %q", raw)
+		}
+		if !slices.Contains(out, h) {
+			out = append(out, h)
+		}
+	}
+	return strings.Join(out, ","), nil
+}
+
+// splitHostList is the inverse of normalizeHostList's join.
+func splitHostList(v string) []string {
+	if v == "" {
+		return []string{}
+	}
+	return strings.Split(v, ",")
+}
+
+// hostListMatches reports whether host is one of list's hosts or a
+// subdomain of one.
+func hostListMatches(list, host string) bool {
+	for _, h := range splitHostList(list) {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDestinationHost applies blocked_hosts and allowed_hosts to a long
+// URL. An empty allowlist allows every host that is not blocked.
+func checkDestinationHost(longURL string) error {
+	u, err := url.Parse(longURL)
+	if err != nil {
+		return nil // not a URL; left to the other checks
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if hostListMatches(cfg.setting("blocked_hosts"), host) {
+		return fmt.Errorf("%w: %s", errHostNotAllowed, host)
+	}
+	if allowed := cfg.setting("allowed_hosts"); allowed != "" && !hostListMatches(allowed, host) {
+		return fmt.Errorf("%w: %s", errHostNotAllowed, cmp.Or(host, longURL))
+	}
+	return nil
+}
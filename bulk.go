@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+type bulkResult struct {
+	Index  int    `json:"index"`  // 0-based position in the request array
+	Status string `json:"status"` // created or failed
+	Error  string `json:"error,omitempty"`
+	*linkView
+}
+
+// shortenBulkHandler serves POST /shorten/bulk: a JSON array of /shorten
+// bodies (without og_image_file uploads), created in one transaction. Each
+// item runs under its own savepoint, so a taken alias or invalid item is
+// reported in its result and the rest still go in. At most bulkShortenMax
+// items per request.
+func shortenBulkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var items []shortenRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportBytes)).Decode(&items); err != nil {
+		jsonError(w, http.StatusBadRequest, "body must be a JSON array of /shorten objects")
+		return
+	}
+	if len(items) == 0 {
+		jsonError(w, http.StatusBadRequest, "no items")
+		return
+	}
+	if len(items) > bulkShortenMax {
+		jsonError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d items per request", bulkShortenMax))
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	defer tx.Rollback()
+
+	results := make([]bulkResult, len(items))
+	codes := make([]string, len(items))
+	for i, item := range items {
+		results[i] = bulkResult{Index: i, Status: "failed"}
+		rec, code, err := item.record()
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if code, err = insertURLSavepoint(tx, code, rec); isUniqueViolation(err) {
+			results[i].Error = fmt.Sprintf("alias '%s' is already taken", code)
+			continue
+		} else if err != nil {
+			log.Printf("bulk shorten item %d: %v", i, err)
+			results[i].Error = "database error"
+			continue
+		}
+		codes[i] = code
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+
+	created := 0
+	for i, code := range codes {
+		if code == "" {
+			continue
+		}
+		created++
+		row, err := getURLRow(code)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		logAuditBestEffort(code, auditCreate, "", row.LongURL, clientIP(r))
+		fetchTitle(code, row.LongURL)
+		v := linkJSON(row)
+		results[i].Status, results[i].linkView = "created", &v
+	}
+	if created > 0 {
+		markChanged()
+	}
+
+	writeJSON(w, r, http.StatusOK, map[string]any{
+		"created": created,
+		"failed":  len(items) - created,
+		"results": results,
+	})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	checkWorkers        = 8
+	checkRequestTimeout = 5 * time.Second
+	checkTotalTimeout   = 30 * time.Second
+)
+
+// checkClient reports redirects as-is instead of following them.
+var checkClient = &http.Client{
+	Timeout: checkRequestTimeout,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+type checkResult struct {
+	Code       string `json:"code"`
+	URL        string `json:"url,omitempty"`
+	Status     string `json:"status"` // 2xx, 3xx, 4xx, 5xx, timeout, error, not_found, skipped
+	HTTPStatus int    `json:"http_status,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// checkDestination issues a HEAD request (falling back to GET for servers
+// that refuse HEAD) and classifies the outcome.
+func checkDestination(ctx context.Context, dest string) checkResult {
+	res := checkResult{URL: dest}
+	if u, err := url.Parse(dest); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		res.Status, res.Error = "skipped", "not an http(s) URL"
+		return res
+	}
+	var resp *http.Response
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, dest, nil)
+		if err != nil {
+			res.Status, res.Error = "error", err.Error()
+			return res
+		}
+		req.Header.Set("User-Agent", "gourl-link-checker")
+		if resp, err = checkClient.Do(req); err != nil {
+			var ue *url.Error
+			if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &ue) && ue.Timeout()) {
+				res.Status = "timeout"
+			} else {
+				res.Status, res.Error = "error", err.Error()
+			}
+			return res
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+			break
+		}
+	}
+	res.HTTPStatus = resp.StatusCode
+	res.Status = fmt.Sprintf("%dxx", resp.StatusCode/100)
+	return res
+}
+
+// checkURLsHandler serves POST /check-urls on the internal host. The body
+// {"codes": [...]} selects links; an empty list (or body) checks every link.
+// Destinations are probed by a bounded worker pool within checkTotalTimeout.
+func checkURLsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Codes []string `json:"codes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		jsonError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	results := []checkResult{}
+	if len(body.Codes) == 0 {
+		urls, err := getAllURLs()
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		for _, u := range urls {
+			results = append(results, checkResult{Code: u.Code, URL: u.LongURL})
+		}
+	} else {
+		for _, code := range body.Codes {
+			rec, err := getRecord(code)
+			if err == sql.ErrNoRows {
+				results = append(results, checkResult{Code: code, Status: "not_found"})
+				continue
+			} else if err != nil {
+				jsonError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			results = append(results, checkResult{Code: code, URL: rec.LongURL})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), checkTotalTimeout)
+	defer cancel()
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range checkWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				res := checkDestination(ctx, results[i].URL)
+				res.Code = results[i].Code
+				results[i] = res
+			}
+		}()
+	}
+	for i := range results {
+		if results[i].Status == "" {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	writeJSON(w, r, http.StatusOK, map[string]any{"results": results})
+}
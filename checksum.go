@@ -0,0 +1,130 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// With CODE_CHECKSUM enabled, generated codes carry one extra check
+// character so mistyped links can be told apart from unknown ones.
+//
+// Algorithm: let v_i be the index in charset of the i-th character (i = 1..n)
+// of the random part. The check character is charset[(Σ i·v_i) mod len(charset)].
+// With a prime len(charset) (23 by default) and n < len(charset), every
+// single-character substitution and every transposition of two characters
+// in the random part changes the sum and is detected. Custom codes are never
+// checksummed.
+
+func checksumChar(code string) byte {
+	sum := 0
+	for i := 0; i < len(code); i++ {
+		sum += (i + 1) * strings.IndexByte(charset, code[i])
+	}
+	return charset[sum%len(charset)]
+}
+
+// looksChecksummed reports whether code has the shape of a generated
+// checksummed code: at least codeLen+1 characters (codes grow after
+// collisions, see generateCode), all from charset.
+func looksChecksummed(code string) bool {
+	if len(code) < codeLen+1 {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		if strings.IndexByte(charset, code[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func validChecksum(code string) bool {
+	n := len(code) - 1
+	return checksumChar(code[:n]) == code[n]
+}
+
+// typoCandidates lists checksum-valid codes one substitution or one adjacent
+// transposition away from code.
+func typoCandidates(code string) []string {
+	var out []string
+	b := []byte(code)
+	try := func() {
+		if c := string(b); c != code && validChecksum(c) {
+			out = append(out, c)
+		}
+	}
+	for i := range b {
+		orig := b[i]
+		for j := 0; j < len(charset); j++ {
+			b[i] = charset[j]
+			try()
+		}
+		b[i] = orig
+	}
+	for i := 0; i+1 < len(b); i++ {
+		b[i], b[i+1] = b[i+1], b[i]
+		try()
+		b[i], b[i+1] = b[i+1], b[i]
+	}
+	return out
+}
+
+// suggestCodes returns existing links, enabled for the requested link type,
+// that code is most likely a typo of.
+func suggestCodes(code string, internal bool) []string {
+	cands := typoCandidates(code)
+	if len(cands) == 0 {
+		return nil
+	}
+	col := "public_enabled"
+	if internal {
+		col = "internal_enabled"
+	}
+	args := make([]any, len(cands))
+	for i, c := range cands {
+		args[i] = c
+	}
+	rows, err := db.Query(
+		"SELECT code FROM urls WHERE "+col+" = 1 AND "+liveLink+" AND code IN (?"+strings.Repeat(", ?", len(cands)-1)+") ORDER BY code",
+		args...,
+	)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var c string
+		if rows.Scan(&c) == nil {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+var didYouMeanTmpl = template.Must(template.New("didyoumean").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="UTF-8"><meta name="robots" content="noindex,nofollow"><title>Link not found</title>
+<style>:root{color-scheme:light dark}body{margin:0;min-height:100vh;display:flex;align-items:center;justify-content:center;background-color:Canvas;color:CanvasText;font-family:system-ui,sans-serif;font-size:.9rem;text-align:center}a{color:LinkText}ul{list-style:none;padding:0}li{margin:.3rem 0;font-family:ui-monospace,monospace}</style>
+</head>
+<body><div><p style="font-size:1.1rem">“{{.Code}}” looks mistyped.</p>
+{{if .Suggestions}}<p>Did you mean:</p>
+<ul>{{range .Suggestions}}<li><a href="/{{.}}">{{.}}</a></li>{{end}}</ul>
+{{else}}<p>Please check the link and try again.</p>{{end}}</div></body>
+</html>`))
+
+// typoResponse writes a 404 "did you mean" page when code is a checksummed
+// code that fails its checksum, and reports whether it did.
+func typoResponse(w http.ResponseWriter, code string, internal bool) bool {
+	if !codeChecksum || !looksChecksummed(code) || validChecksum(code) {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	didYouMeanTmpl.Execute(w, struct {
+		Code        string
+		Suggestions []string
+	}{code, suggestCodes(code, internal)})
+	return true
+}
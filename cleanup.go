@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// startCleanup launches the background job that deletes dead links and
+// purges the trash every CLEANUP_INTERVAL. It does nothing when the interval
+// is 0.
+func startCleanup() {
+	if cleanupInterval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			if n, err := cleanupLinks(); err != nil {
+				log.Printf("cleanup: %v", err)
+			} else {
+				log.Printf("cleanup: removed %d expired or exhausted links", n)
+			}
+			if n, err := purgeTrash(); err != nil {
+				log.Printf("cleanup: purge trash: %v", err)
+			} else if n > 0 {
+				log.Printf("cleanup: purged %d links from the trash", n)
+			}
+			time.Sleep(cleanupInterval)
+		}
+	}()
+}
+
+// cleanupLinks deletes live links past their expiry (and expiry_grace),
+// idle for longer than expire_after_idle, or at their use limit, with their
+// clicks and uploaded images, in one transaction. Each DELETE re-checks the
+// expiry, limit and last use it saw, so a link extended or used in the
+// meantime survives, and a second pass over the same rows is a no-op.
+func cleanupLinks() (int, error) {
+	rows, err := queryURLs("SELECT " + rowColumns + " FROM urls WHERE " + liveLink + " AND (expires_at != '' OR expire_after_idle != '' OR (max_uses > 0 AND use_count >= max_uses))")
+	if err != nil {
+		return 0, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var codes, images []string
+	for _, u := range rows {
+		if gone, _ := linkExpiry(u.ExpiresAt); !gone && !u.IdleExpired && !u.UsesExhausted {
+			continue
+		}
+		res, err := tx.Exec("DELETE FROM urls WHERE code = ? AND expires_at = ? AND max_uses = ? AND expire_after_idle = ? AND last_accessed_at = ? AND "+liveLink,
+			u.Code, u.ExpiresAt, u.MaxUses, u.ExpireAfterIdle, u.LastAccessedAt)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		if _, err := tx.Exec("DELETE FROM clicks WHERE code = ?", u.Code); err != nil {
+			return 0, err
+		}
+		if err := logAudit(tx, u.Code, auditDelete, u.LongURL, "", "cleanup"); err != nil {
+			return 0, err
+		}
+		codes = append(codes, u.Code)
+		images = append(images, u.OGImageFile)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	removed := len(codes)
+	if removed > 0 {
+		markChanged()
+		forgetRecord(codes...)
+	}
+	for _, name := range images {
+		removeOGImageFile(name)
+	}
+	return removed, nil
+}
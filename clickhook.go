@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// When the webhook_url setting is set, every successful redirect of a link
+// without no_analytics is POSTed there as a clickEvent. Events go through a
+// bounded queue drained by clickHookWorkers, so a slow endpoint never delays
+// a redirect: when the queue is full the event is dropped. Each delivery is
+// tried clickHookAttempts times with doubling backoff; failures are only
+// logged.
+const (
+	clickHookQueueSize = 1000
+	clickHookWorkers   = 4
+	clickHookAttempts  = 3
+	clickHookBackoff   = time.Second
+)
+
+type clickEvent struct {
+	Event       string `json:"event"` // always "link.click"
+	Code        string `json:"code"`
+	Destination string `json:"destination"`
+	Host        string `json:"host"` // public, alias or internal
+	Timestamp   string `json:"timestamp"`
+	UserAgent   string `json:"user_agent"`
+}
+
+type clickDelivery struct {
+	url   string
+	event clickEvent
+}
+
+var clickHookQueue = make(chan clickDelivery, clickHookQueueSize)
+
+// startClickHook launches the delivery workers. They idle on the queue, so
+// the webhook can be switched on later from the settings.
+func startClickHook() {
+	for range clickHookWorkers {
+		go func() {
+			for d := range clickHookQueue {
+				deliverClick(d)
+			}
+		}()
+	}
+}
+
+// notifyClick queues a click for the webhook, if one is configured.
+func notifyClick(code, dest, host, userAgent string) {
+	url := cfg.setting("webhook_url")
+	if url == "" {
+		return
+	}
+	if len(userAgent) > maxClickHeaderLen {
+		userAgent = userAgent[:maxClickHeaderLen]
+	}
+	d := clickDelivery{url, clickEvent{
+		Event:       "link.click",
+		Code:        code,
+		Destination: dest,
+		Host:        host,
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		UserAgent:   userAgent,
+	}}
+	select {
+	case clickHookQueue <- d:
+	default:
+		clickHookTotal.WithLabelValues("dropped").Inc()
+		log.Printf("click webhook: queue full, dropped click on %s", code)
+	}
+}
+
+func deliverClick(d clickDelivery) {
+	backoff := clickHookBackoff
+	for attempt := 1; ; attempt++ {
+		err := postWebhook(d.url, d.event)
+		if err == nil {
+			clickHookTotal.WithLabelValues("sent").Inc()
+			return
+		}
+		if attempt == clickHookAttempts {
+			clickHookTotal.WithLabelValues("failed").Inc()
+			log.Printf("click webhook: %s: giving up after %d attempts: %v", d.event.Code, attempt, err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -1,15 +1,128 @@
 package main
 
 import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
 	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	port   = envOr("PORT", ":80")
-	dbFile = envOr("DB_FILE", "urls.db")
+	port     = envOr("PORT", ":80")
+	dbFile   = envOr("DB_FILE", "urls.db")
+	dbDriver = envOr("DB_DRIVER", "sqlite")
+	dbDSN    = envOr("DB_DSN", "") // overrides DB_FILE; required for non-SQLite drivers
+	seedFile = envOr("SEED_FILE", "")
+
+	// sqliteBusyTimeout is how long SQLite waits on a locked database before
+	// failing with "database is locked".
+	sqliteBusyTimeout = envDuration("SQLITE_BUSY_TIMEOUT", 5*time.Second)
+
+	// recordCacheSize caps how many links the redirect path keeps in memory,
+	// each for at most recordCacheTTL. 0 disables the cache.
+	recordCacheSize = envInt("RECORD_CACHE_SIZE", 1000)
+	recordCacheTTL  = envDuration("RECORD_CACHE_TTL", 10*time.Second)
+
+	// adminResetToken enables POST /admin/reset on the internal host when set.
+	adminResetToken = envOr("ADMIN_RESET_TOKEN", "")
+
+	// redirectCacheTTL is the default Cache-Control max-age (seconds) for
+	// successful redirects; -1 sends no Cache-Control header, 0 sends no-store.
+	redirectCacheTTL = envInt("REDIRECT_CACHE_TTL", -1)
+
+	// deleteConfirmClicks: deleting a link with more recorded redirects than
+	// this requires ?confirm=<count>. 0 disables the check.
+	deleteConfirmClicks = envInt("DELETE_CONFIRM_CLICKS", 100)
+
+	// Link password policy; both default to 0 (no requirement). Character
+	// classes are lowercase, uppercase, digits and everything else.
+	passwordMinLength  = envInt("PASSWORD_MIN_LENGTH", 0)
+	passwordMinClasses = envInt("PASSWORD_MIN_CLASSES", 0)
+
+	// passwordBcryptCost is the bcrypt work factor for new link passwords
+	// (clamped to bcrypt's 4–31).
+	passwordBcryptCost = envInt("PASSWORD_BCRYPT_COST", bcrypt.DefaultCost)
+
+	// Expiry notifier (see notify.go): links get one heads-up when they come
+	// within expiryNotifyWindow of expiring. 0 disables the notifier; with no
+	// webhook URL the heads-up is only logged.
+	expiryNotifyWindow = envDuration("EXPIRY_NOTIFY_WINDOW", 0)
+	expiryWebhookURL   = envOr("EXPIRY_WEBHOOK_URL", "")
+
+	// cleanupInterval is how often expired (past expiry_grace) and exhausted
+	// links are deleted (see cleanup.go); 0 disables the job.
+	cleanupInterval = envDuration("CLEANUP_INTERVAL", 0)
+
+	// trashRetention is how long deleted links stay restorable before the
+	// cleanup job purges them (see trash.go); 0 keeps them until purged by hand.
+	trashRetention = envDuration("TRASH_RETENTION", 30*24*time.Hour)
+
+	// codeChecksum appends a check character to generated codes (see checksum.go).
+	codeChecksum = envBool("CODE_CHECKSUM", false)
+
+	// Generated codes (see generateCode): codeLen characters from charset,
+	// one more for every codeGrowAfter collisions in a row (0 = never grow).
+	// Checked by checkCodeConfig at startup.
+	codeLen       = envInt("CODE_LEN", 6)
+	charset       = envOr("CODE_CHARSET", "abcdefghkprstxyz2345678")
+	codeGrowAfter = envInt("CODE_GROW_AFTER", 3)
+
+	// fetchTitles fetches each new destination's <title> once for the UI label.
+	fetchTitles = envBool("FETCH_TITLES", true)
+
+	// ogImageDir holds uploaded og:images (see ogimage.go).
+	ogImageDir = envOr("OG_IMAGE_DIR", "og-images")
+
+	// Inbound webhook (see hook.go): POST /hook/{HOOK_SECRET} creates links;
+	// disabled when the secret is empty. The limit is requests per minute per
+	// client IP (0 = unlimited).
+	hookSecret    = envOr("HOOK_SECRET", "")
+	hookRateLimit = envInt("HOOK_RATE_LIMIT", 30)
+
+	// Failed /pass/ attempts allowed per link and client IP within the window
+	// before 429s (0 = unlimited).
+	passMaxFailures   = envInt("PASS_MAX_FAILURES", 5)
+	passFailureWindow = envDuration("PASS_FAILURE_WINDOW", 15*time.Minute)
+
+	// trustProxy makes clientIP take the address the reverse proxy appended
+	// to X-Forwarded-For instead of the connection's (see clientIP).
+	trustProxy = envBool("TRUST_PROXY", false)
+
+	// bulkShortenMax caps the items in one POST /shorten/bulk request.
+	bulkShortenMax = envInt("BULK_SHORTEN_MAX", 500)
+
+	// batchMax caps the codes in one POST /urls/batch or /urls/tag request.
+	batchMax = envInt("BATCH_MAX", 500)
+
+	// sessionTTL is how long an admin login lasts (see auth.go).
+	sessionTTL = envDuration("SESSION_TTL", 24*time.Hour)
+
+	// logFormat selects the access log (see accessLog): text, json or off.
+	logFormat = envOr("LOG_FORMAT", "text")
+
+	// shutdownTimeout is how long SIGINT/SIGTERM waits for in-flight
+	// requests before closing the database anyway.
+	shutdownTimeout = envDuration("SHUTDOWN_TIMEOUT", 15*time.Second)
+
+	// codeBlockRegex rejects matching custom codes (see blockedCode); nil
+	// when CODE_BLOCK_REGEX is unset.
+	codeBlockRegex = envRegexp("CODE_BLOCK_REGEX")
+
+	// reservedCodes are custom codes refused on top of the route names (see
+	// reservedCode), from the comma-separated RESERVED_CODES.
+	reservedCodes = envList("RESERVED_CODES")
 )
 
 func envOr(key, fallback string) string {
@@ -19,6 +132,104 @@ func envOr(key, fallback string) string {
 	return fallback
 }
 
+func envBool(key string, fallback bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("ignoring invalid %s=%q: %v", key, v, err)
+		return fallback
+	}
+	return b
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err == nil && d < 0 {
+		err = errors.New("negative duration")
+	}
+	if err != nil {
+		log.Printf("ignoring invalid %s=%q: %v", key, v, err)
+		return fallback
+	}
+	return d
+}
+
+func envInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("ignoring invalid %s=%q: %v", key, v, err)
+		return fallback
+	}
+	return n
+}
+
+// checkCodeConfig validates CODE_LEN and CODE_CHARSET: generated codes must
+// pass validCode, so the charset is limited to its characters and the
+// length (plus a check character) to 32.
+func checkCodeConfig() error {
+	if codeLen < 1 || codeLen+boolToInt(codeChecksum) > 32 {
+		return fmt.Errorf("CODE_LEN must be 1–%d, got %d", 32-boolToInt(codeChecksum), codeLen)
+	}
+	if len(charset) < 2 || !validCode.MatchString(charset) {
+		return fmt.Errorf("CODE_CHARSET must be at least 2 of a-z, A-Z, 0-9, '-' and '_', got %q", charset)
+	}
+	for i := range len(charset) {
+		if strings.IndexByte(charset[i+1:], charset[i]) >= 0 {
+			return fmt.Errorf("CODE_CHARSET repeats %q", charset[i])
+		}
+	}
+	if codeChecksum && !isPrime(len(charset)) {
+		log.Printf("warning: CODE_CHARSET has %d characters; with CODE_CHECKSUM a prime length catches every typo", len(charset))
+	}
+	return nil
+}
+
+func isPrime(n int) bool {
+	for d := 2; d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return n > 1
+}
+
+// envList splits a comma-separated variable, dropping blank entries.
+func envList(key string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// envRegexp compiles key's value, or returns nil when it is unset. A policy
+// that silently failed to apply would be worse than not starting, so an
+// invalid pattern is fatal.
+func envRegexp(key string) *regexp.Regexp {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	re, err := regexp.Compile(v)
+	if err != nil {
+		log.Fatalf("invalid %s=%q: %v", key, v, err)
+	}
+	return re
+}
+
 // appConfig holds the configurable hostnames. Safe for concurrent reads/writes
 // since settings can be updated live via the web UI.
 type appConfig struct {
@@ -27,8 +238,262 @@ type appConfig struct {
 	PublicHost    string // hostname only,  e.g. pmh.codes
 	UIHost        string // full URL, e.g. https://links.pmh.codes
 	InternalHost  string // full URL, e.g. http://go
-	AliasHost     string // full URL, e.g. https://pmh.so (alternate public redirect host)
+	AliasHost     string // full URLs, comma-separated, e.g. https://pmh.so,https://pmh.link (alternate public redirect hosts; the first is the primary)
 	PublicAPIHost string // full URL, e.g. https://api.pmh.codes (public API endpoint)
+
+	values map[string]string // runtime settings, keyed by runtimeSetting.key
+}
+
+// settingKind controls how a runtime setting is validated and rendered as JSON.
+type settingKind int
+
+const (
+	settingString settingKind = iota
+	settingBool
+	settingDuration     // Go duration string, e.g. "24h"; never negative
+	settingURL          // absolute http(s) URL, or empty
+	settingSecret       // stored as its bcrypt hash; GET /settings only says whether it is set
+	settingHostList     // hostnames, stored comma-separated; a JSON array in GET/PATCH /settings
+	settingTemplate     // html/template source for a redirect page (see redirectPageData), or empty
+	settingTimezone     // IANA time zone name such as "Europe/Berlin"
+	settingRedirectType // redirect, meta or js (see defaultRedirectTypes)
+)
+
+// runtimeSetting describes a live-editable option beyond the hostnames. Its
+// value comes from the settings table, else the env var, else fallback, and
+// is exposed under key in GET/PATCH /settings.
+type runtimeSetting struct {
+	key      string // settings table key and JSON field name
+	env      string
+	fallback string
+	kind     settingKind
+}
+
+var runtimeSettings = []runtimeSetting{
+	// maintenance: every host answers 503 except to admins on the UI and
+	// internal hosts.
+	{key: "maintenance", env: "MAINTENANCE", kind: settingBool},
+	// expiry_grace: how long past expires_at a link keeps redirecting (with a warning).
+	{key: "expiry_grace", env: "EXPIRY_GRACE", fallback: "0s", kind: settingDuration},
+	// canonical_link: send Link: <dest>; rel="canonical" on interstitial pages
+	// (meta/js redirects, expiry grace) so crawlers credit the destination.
+	{key: "canonical_link", env: "CANONICAL_LINK", kind: settingBool},
+	// noindex: X-Robots-Tag and a disallow-all robots.txt on the UI and
+	// internal hosts (see robots.go).
+	{key: "noindex", env: "NOINDEX", fallback: "true", kind: settingBool},
+	// forward_query_prefer_destination: for forward_query links, keep the
+	// destination's value of a parameter the request also has, instead of
+	// the request's.
+	{key: "forward_query_prefer_destination", env: "FORWARD_QUERY_PREFER_DESTINATION", kind: settingBool},
+	// internal_root_redirect: when set, / on the internal host redirects here
+	// instead of rendering the UI.
+	{key: "internal_root_redirect", env: "INTERNAL_ROOT_REDIRECT", kind: settingURL},
+	// not_found_redirect / internal_not_found_redirect: where unknown codes
+	// and disabled, expired or used-up links send visitors on the public (and
+	// alias) hosts / the internal host, instead of the 404 page.
+	{key: "not_found_redirect", env: "NOT_FOUND_REDIRECT", kind: settingURL},
+	{key: "internal_not_found_redirect", env: "INTERNAL_NOT_FOUND_REDIRECT", kind: settingURL},
+	// admin_password: when set, the UI and management API require a login.
+	{key: "admin_password", env: "ADMIN_PASSWORD", kind: settingSecret},
+	// blocked_hosts / allowed_hosts: destination hosts refused, or (when the
+	// allowlist is non-empty) the only ones accepted; see checkDestinationHost.
+	{key: "blocked_hosts", env: "BLOCKED_HOSTS", kind: settingHostList},
+	{key: "allowed_hosts", env: "ALLOWED_HOSTS", kind: settingHostList},
+	// cors_origins: hosts (and their subdomains) of browser front-ends that
+	// may call /shorten and /urls/{code} on the public API host, besides the
+	// public and alias bases.
+	{key: "cors_origins", env: "CORS_ORIGINS", kind: settingHostList},
+	// meta_template / js_template: custom pages for the meta and js redirect
+	// types, in place of the built-in ones.
+	{key: "meta_template", env: "META_TEMPLATE", kind: settingTemplate},
+	{key: "js_template", env: "JS_TEMPLATE", kind: settingTemplate},
+	// site_title / favicon_url: the UI's page title and icon, to tell
+	// instances apart; an empty favicon_url uses the built-in icon.
+	{key: "site_title", env: "SITE_TITLE", fallback: defaultSiteTitle, kind: settingString},
+	{key: "favicon_url", env: "FAVICON_URL", kind: settingURL},
+	// timezone: zone the UI and the *_display fields of the API show
+	// created_at and expires_at in; ?tz= overrides it per request.
+	{key: "timezone", env: "TIMEZONE", fallback: "UTC", kind: settingTimezone},
+	// webhook_url: receives a JSON POST for every redirect (see clickhook.go).
+	{key: "webhook_url", env: "WEBHOOK_URL", kind: settingURL},
+	// default_redirect_type: redirect_type of new links that name none.
+	{key: "default_redirect_type", env: "DEFAULT_REDIRECT_TYPE", fallback: "redirect", kind: settingRedirectType},
+}
+
+const defaultSiteTitle = "URL Shortener"
+
+// parse validates a JSON value from a settings PATCH and normalizes it to
+// the string form stored in the settings table.
+func (d runtimeSetting) parse(raw json.RawMessage) (string, error) {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", err
+	}
+	switch d.kind {
+	case settingBool:
+		switch x := v.(type) {
+		case bool:
+			return strconv.FormatBool(x), nil
+		case string:
+			if b, err := strconv.ParseBool(x); err == nil {
+				return strconv.FormatBool(b), nil
+			}
+		}
+		return "", errors.New("must be a boolean")
+	case settingDuration:
+		str, ok := v.(string)
+		if !ok {
+			return "", errors.New("must be a duration string such as \"24h\"")
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(str))
+		if err != nil || d < 0 {
+			return "", errors.New("must be a non-negative duration such as \"24h\"")
+		}
+		return d.String(), nil
+	case settingURL:
+		str, ok := v.(string)
+		if !ok {
+			return "", errors.New("must be a string")
+		}
+		str = strings.TrimSpace(str)
+		if str == "" {
+			return "", nil
+		}
+		if u, err := url.Parse(str); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "", errors.New("must be an absolute http(s) URL")
+		}
+		return str, nil
+	case settingSecret:
+		str, ok := v.(string)
+		if !ok {
+			return "", errors.New("must be a string")
+		}
+		if str == "" {
+			return "", nil
+		}
+		return hashLinkPassword(str)
+	case settingHostList:
+		var hosts []string
+		if err := json.Unmarshal(raw, &hosts); err != nil {
+			return "", errors.New("must be an array of hostnames")
+		}
+		return normalizeHostList(hosts)
+	case settingTemplate:
+		str, ok := v.(string)
+		if !ok {
+			return "", errors.New("must be a string")
+		}
+		if strings.TrimSpace(str) == "" {
+			return "", nil
+		}
+		if _, err := parseRedirectTemplate(d.key, str); err != nil {
+			return "", fmt.Errorf("is not a valid template: %v", err)
+		}
+		return str, nil
+	case settingTimezone:
+		str, ok := v.(string)
+		if !ok {
+			return "", errors.New("must be a string")
+		}
+		str = strings.TrimSpace(str)
+		if _, err := loadLocation(str); err != nil {
+			return "", errors.New("must be an IANA time zone such as \"Europe/Berlin\"")
+		}
+		return cmp.Or(str, "UTC"), nil
+	case settingRedirectType:
+		str, ok := v.(string)
+		if !ok {
+			return "", errors.New("must be a string")
+		}
+		str = cmp.Or(strings.TrimSpace(str), "redirect")
+		if !slices.Contains(defaultRedirectTypes, str) {
+			return "", errors.New("must be redirect, meta or js")
+		}
+		return str, nil
+	default:
+		str, ok := v.(string)
+		if !ok {
+			return "", errors.New("must be a string")
+		}
+		return strings.TrimSpace(str), nil
+	}
+}
+
+// jsonValue renders a stored value with its natural JSON type.
+func (d runtimeSetting) jsonValue(v string) any {
+	switch d.kind {
+	case settingBool:
+		b, _ := strconv.ParseBool(v)
+		return b
+	case settingSecret:
+		return v != ""
+	case settingHostList:
+		return splitHostList(v)
+	}
+	return v
+}
+
+// parseRuntimeSettings extracts and validates the runtime settings present in
+// a settings PATCH body. Keys that are absent are not returned.
+func parseRuntimeSettings(body []byte) (map[string]string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	out := map[string]string{}
+	for _, def := range runtimeSettings {
+		raw, ok := fields[def.key]
+		if !ok {
+			continue
+		}
+		v, err := def.parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s %w", def.key, err)
+		}
+		out[def.key] = v
+	}
+	return out, nil
+}
+
+// setting returns the current value of a runtime setting.
+func (c *appConfig) setting(key string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.values[key]
+}
+
+// enabled reports whether a boolean runtime setting is on.
+func (c *appConfig) enabled(key string) bool {
+	b, _ := strconv.ParseBool(c.setting(key))
+	return b
+}
+
+func (c *appConfig) setSettings(values map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = map[string]string{}
+	}
+	for k, v := range values {
+		c.values[k] = v
+	}
+}
+
+// duration returns a duration runtime setting, or 0 when unset or invalid.
+func (c *appConfig) duration(key string) time.Duration {
+	d, _ := time.ParseDuration(c.setting(key))
+	return max(d, 0)
+}
+
+// runtimeSettingsJSON returns every runtime setting keyed for GET /settings.
+func (c *appConfig) runtimeSettingsJSON() map[string]any {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make(map[string]any, len(runtimeSettings))
+	for _, def := range runtimeSettings {
+		out[def.key] = def.jsonValue(c.values[def.key])
+	}
+	return out
 }
 
 var cfg = &appConfig{}
@@ -44,14 +509,19 @@ func (c *appConfig) snapshot() (publicBase, publicHost, uiHost, internalHost, al
 func (c *appConfig) publicAPIBase() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	if c.PublicAPIHost == "" {
+	return c.baseURL(c.PublicAPIHost)
+}
+
+// baseURL turns a configured host into a URL prefix. Full URLs are kept;
+// legacy bare hostnames take PublicBase's scheme. Callers hold c.mu.
+func (c *appConfig) baseURL(v string) string {
+	if v == "" {
 		return ""
 	}
-	v := strings.TrimRight(c.PublicAPIHost, "/")
+	v = strings.TrimRight(v, "/")
 	if strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://") {
 		return v
 	}
-	// Legacy bare hostname — derive scheme from PublicBase.
 	u, _ := url.Parse(c.PublicBase)
 	if u != nil && u.Scheme != "" {
 		return u.Scheme + "://" + v
@@ -65,24 +535,56 @@ func (c *appConfig) publicAPIHostVal() string {
 	return c.PublicAPIHost
 }
 
-// aliasBase returns the full URL prefix for the alias host (e.g. https://pmh.so).
-// Returns "" when no alias host is set. Handles both full URLs and legacy bare hostnames.
-func (c *appConfig) aliasBase() string {
+// aliasBases returns the full URL prefix of every alias host (e.g.
+// https://pmh.so), the primary one first.
+func (c *appConfig) aliasBases() []string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	if c.AliasHost == "" {
+	var bases []string
+	for _, h := range splitAliasHosts(c.AliasHost) {
+		bases = append(bases, c.baseURL(h))
+	}
+	return bases
+}
+
+// aliasBase returns the alias base to build links with for r: the alias
+// host r came in on, else the primary one (also when r is nil, outside a
+// request on an alias host). Returns "" when no alias host is set.
+func (c *appConfig) aliasBase(r *http.Request) string {
+	bases := c.aliasBases()
+	if len(bases) == 0 {
 		return ""
 	}
-	v := strings.TrimRight(c.AliasHost, "/")
-	if strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://") {
-		return v
+	if r != nil {
+		host := effectiveHost(r)
+		for _, b := range bases {
+			if hostOf(b) == host {
+				return b
+			}
+		}
 	}
-	// Legacy bare hostname — derive scheme from PublicBase.
-	u, _ := url.Parse(c.PublicBase)
-	if u != nil && u.Scheme != "" {
-		return u.Scheme + "://" + v
+	return bases[0]
+}
+
+// splitAliasHosts splits the comma-separated alias_host setting.
+func splitAliasHosts(v string) []string {
+	var hosts []string
+	for _, h := range strings.Split(v, ",") {
+		if h = strings.TrimRight(strings.TrimSpace(h), "/"); h != "" {
+			hosts = append(hosts, h)
+		}
 	}
-	return "https://" + v
+	return hosts
+}
+
+// normalizeAliasHosts is the stored form of an alias host list: a single
+// host (the pre-list form) stays as it was.
+func normalizeAliasHosts(hosts []string) string {
+	var out []string
+	for _, h := range hosts {
+		out = append(out, splitAliasHosts(h)...)
+	}
+	return strings.Join(out, ",")
 }
 
 func (c *appConfig) apply(publicBase, uiHost, internalHost, aliasHost, publicAPIHost string) {
@@ -98,23 +600,65 @@ func (c *appConfig) apply(publicBase, uiHost, internalHost, aliasHost, publicAPI
 	c.PublicAPIHost = publicAPIHost
 }
 
+// checkHostCollisions reports two configured hosts with the same hostname:
+// routeOf would send every request for it to whichever it checks first.
+// Unset hosts are skipped.
+func checkHostCollisions(publicBase, uiHost, internalHost, aliasHost, publicAPIHost string) error {
+	type named struct{ key, host string }
+	hosts := []named{{"public_base", publicBase}, {"ui_host", uiHost}, {"internal_host", internalHost}}
+	for _, a := range splitAliasHosts(aliasHost) {
+		hosts = append(hosts, named{"alias_host", a})
+	}
+	hosts = append(hosts, named{"public_api_host", publicAPIHost})
+	seen := map[string]string{}
+	for _, h := range hosts {
+		name, _, _ := strings.Cut(hostOf(h.host), "/")
+		name, _, _ = strings.Cut(strings.ToLower(name), ":")
+		if name == "" {
+			continue
+		}
+		if prev, ok := seen[name]; ok {
+			return fmt.Errorf("%s and %s are both %q", prev, h.key, name)
+		}
+		seen[name] = h.key
+	}
+	return nil
+}
+
 func loadSettings() error {
 	publicBase := envOr("BASE_URL", "http://localhost")
 	uiHost := envOr("UI_HOST", "http://links.localhost")
 	internalHost := envOr("INTERNAL_HOST", "http://go")
-	aliasHost := envOr("ALIAS_HOST", "")
+	aliasHost := normalizeAliasHosts([]string{envOr("ALIAS_HOST", "")})
 	publicAPIHost := envOr("PUBLIC_API_HOST", "")
-
-	rows, err := db.Query("SELECT key, value FROM settings")
-	if err != nil {
-		return err
+	values := map[string]string{}
+	source := map[string]string{}
+	for _, h := range hostSettings {
+		source[h.key] = envSource(h.env)
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var k, v string
-		if err := rows.Scan(&k, &v); err != nil {
-			return err
+	for _, def := range runtimeSettings {
+		source[def.key] = envSource(def.env)
+		values[def.key] = envOr(def.env, def.fallback)
+		if def.kind == settingHostList {
+			v, err := normalizeHostList(strings.Split(values[def.key], ","))
+			if err != nil {
+				return fmt.Errorf("%s: %w", def.env, err)
+			}
+			values[def.key] = v
+		}
+		if def.kind == settingTimezone {
+			if _, err := loadLocation(values[def.key]); err != nil {
+				return fmt.Errorf("%s: %w", def.env, err)
+			}
 		}
+		if def.kind == settingRedirectType && !slices.Contains(defaultRedirectTypes, values[def.key]) {
+			return fmt.Errorf("%s: must be redirect, meta or js", def.env)
+		}
+	}
+
+	// set applies a value from the config file or the settings table, in
+	// that order, so the table wins.
+	set := func(k, v, from string) {
 		switch k {
 		case "public_base":
 			publicBase = v
@@ -126,17 +670,63 @@ func loadSettings() error {
 			aliasHost = v
 		case "public_api_host":
 			publicAPIHost = v
+		default:
+			if _, ok := values[k]; !ok {
+				return
+			}
+			values[k] = v
+		}
+		source[k] = from
+	}
+	if configFile != "" {
+		file, err := readConfigFile(configFile)
+		if err != nil {
+			return fmt.Errorf("CONFIG_FILE: %w", err)
+		}
+		for k, v := range file {
+			set(k, v, "config file")
+		}
+	}
+
+	rows, err := db.Query("SELECT key, value FROM settings")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return err
 		}
+		set(k, v, "database")
 	}
 	if err := rows.Err(); err != nil {
 		return err
 	}
+	// Secrets from the env or the config file are still plain text here.
+	for _, def := range runtimeSettings {
+		if def.kind != settingSecret || values[def.key] == "" || source[def.key] == "database" {
+			continue
+		}
+		h, err := envSecretHash(def.key, values[def.key])
+		if err != nil {
+			return fmt.Errorf("%s: %w", def.env, err)
+		}
+		values[def.key] = h
+	}
+	logSettingSources(source)
+	// Refusing to start would take down an instance that has run like this
+	// all along; PATCH /settings rejects such a change instead.
+	if err := checkHostCollisions(publicBase, uiHost, internalHost, aliasHost, publicAPIHost); err != nil {
+		log.Printf("WARNING: ambiguous host configuration, %v; routeOf sends that host to whichever it checks first", err)
+	}
 
 	cfg.apply(publicBase, uiHost, internalHost, aliasHost, publicAPIHost)
+	cfg.setSettings(values)
 	return nil
 }
 
 func saveSetting(key, value string) error {
-	_, err := db.Exec("INSERT OR REPLACE INTO settings (key, value) VALUES (?, ?)", key, value)
+	_, err := db.Exec("INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value", key, value)
 	return err
 }
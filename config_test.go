@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// patchSettings sends body to PATCH /settings and returns the status.
+func patchSettings(t *testing.T, body map[string]any) int {
+	t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	settingsHandler(w, httptest.NewRequest(http.MethodPatch, "/settings", strings.NewReader(string(b))))
+	return w.Code
+}
+
+func TestSettingsHostCollisions(t *testing.T) {
+	pb, _, uh, ih, ah := cfg.snapshot()
+	papi := cfg.publicAPIHostVal()
+	t.Cleanup(func() {
+		patchSettings(t, map[string]any{"public_base": pb, "ui_host": uh, "internal_host": ih, "alias_host": ah, "public_api_host": papi})
+	})
+
+	distinct := map[string]any{
+		"public_base":     "http://pub.test",
+		"ui_host":         "http://ui.test",
+		"internal_host":   "http://go.test",
+		"alias_host":      "http://alias.test",
+		"public_api_host": "http://api.test",
+	}
+	if code := patchSettings(t, distinct); code != http.StatusNoContent {
+		t.Fatalf("distinct hosts: status %d, want %d", code, http.StatusNoContent)
+	}
+
+	keys := []string{"public_base", "ui_host", "internal_host", "alias_host", "public_api_host"}
+	for i, a := range keys {
+		for _, b := range keys[i+1:] {
+			t.Run(a+"/"+b, func(t *testing.T) {
+				hosts := maps.Clone(distinct)
+				// Scheme and port differ; the hostname alone collides.
+				hosts[b] = "https://" + strings.TrimPrefix(distinct[a].(string), "http://") + ":8443"
+				if code := patchSettings(t, hosts); code != http.StatusBadRequest {
+					t.Errorf("status %d, want %d", code, http.StatusBadRequest)
+				}
+				if got, _, _, _, _ := cfg.snapshot(); got != distinct["public_base"] {
+					t.Errorf("public_base changed to %q by a rejected PATCH", got)
+				}
+				if got := cfg.publicAPIHostVal(); got != distinct["public_api_host"] {
+					t.Errorf("public_api_host changed to %q by a rejected PATCH", got)
+				}
+			})
+		}
+	}
+
+	t.Run("alias_hosts", func(t *testing.T) {
+		m := maps.Clone(distinct)
+		delete(m, "alias_host")
+		m["alias_hosts"] = []string{"http://alias.test", "http://UI.test"}
+		if code := patchSettings(t, m); code != http.StatusBadRequest {
+			t.Errorf("status %d, want %d", code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestCheckHostCollisions(t *testing.T) {
+	tests := []struct {
+		name                 string
+		pb, uh, ih, ah, papi string
+		wantErr              bool
+	}{
+		{"distinct", "http://pub.test", "http://ui.test", "http://go", "http://a.test,http://b.test", "http://api.test", false},
+		{"unset optional hosts", "http://pub.test", "http://ui.test", "http://go", "", "", false},
+		{"public and ui", "http://pub.test", "https://pub.test", "http://go", "", "", true},
+		{"case and port", "http://pub.test", "http://PUB.test:8080", "http://go", "", "", true},
+		{"path ignored", "http://pub.test/s", "http://ui.test", "http://pub.test", "", "", true},
+		{"two aliases", "http://pub.test", "http://ui.test", "http://go", "http://a.test,http://a.test", "", true},
+		{"alias and api", "http://pub.test", "http://ui.test", "http://go", "http://a.test", "http://a.test", true},
+	}
+	for _, tt := range tests {
+		err := checkHostCollisions(tt.pb, tt.uh, tt.ih, tt.ah, tt.papi)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
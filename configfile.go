@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// configFile is CONFIG_FILE: a JSON object of settings keyed as in GET
+// /settings (public_base, ui_host, …, maintenance, timezone, …). Its values
+// override the env vars and are overridden by the settings table, which
+// holds what was changed through the UI or PATCH /settings.
+var configFile = os.Getenv("CONFIG_FILE")
+
+// hostSettings are the hostname settings, which are not runtimeSettings,
+// with their env vars.
+var hostSettings = []struct{ key, env string }{
+	{"public_base", "BASE_URL"},
+	{"ui_host", "UI_HOST"},
+	{"internal_host", "INTERNAL_HOST"},
+	{"alias_host", "ALIAS_HOST"},
+	{"public_api_host", "PUBLIC_API_HOST"},
+}
+
+// readConfigFile reads path into stored-form values keyed by setting key.
+// Hostnames must be absolute http(s) URLs (alias_host a string or an array
+// of them); runtime settings are validated as by PATCH /settings. Unknown
+// keys are an error, so a typo doesn't go unnoticed.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	out := map[string]string{}
+	for k, raw := range fields {
+		v, err := parseConfigValue(k, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s %w", path, k, err)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+func parseConfigValue(key string, raw json.RawMessage) (string, error) {
+	hostURL := runtimeSetting{key: key, kind: settingURL}
+	switch key {
+	case "public_base", "ui_host", "internal_host":
+		v, err := hostURL.parse(raw)
+		if err == nil && v == "" {
+			return "", errors.New("must not be empty")
+		}
+		return strings.TrimRight(v, "/"), err
+	case "public_api_host":
+		v, err := hostURL.parse(raw)
+		return strings.TrimRight(v, "/"), err
+	case "alias_host":
+		var hosts []string
+		if json.Unmarshal(raw, &hosts) != nil {
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return "", errors.New("must be a URL or an array of URLs")
+			}
+			hosts = splitAliasHosts(s)
+		}
+		for _, h := range hosts {
+			b, _ := json.Marshal(h)
+			if _, err := hostURL.parse(b); err != nil {
+				return "", err
+			}
+		}
+		return normalizeAliasHosts(hosts), nil
+	}
+	for _, def := range runtimeSettings {
+		if def.key == key && def.kind == settingSecret {
+			// Hashed by loadSettings, which reuses the previous hash.
+			var s string
+			if json.Unmarshal(raw, &s) != nil {
+				return "", errors.New("must be a string")
+			}
+			return s, nil
+		}
+		if def.key == key {
+			return def.parse(raw)
+		}
+	}
+	return "", errors.New("is not a setting")
+}
+
+// envSource names where a setting starts out: its env var, or the default.
+func envSource(env string) string {
+	if os.Getenv(env) != "" {
+		return "env"
+	}
+	return "default"
+}
+
+// logSettingSources logs which source each setting's value came from.
+func logSettingSources(source map[string]string) {
+	var parts []string
+	for _, h := range hostSettings {
+		parts = append(parts, h.key+"="+source[h.key])
+	}
+	for _, def := range runtimeSettings {
+		parts = append(parts, def.key+"="+source[def.key])
+	}
+	log.Printf("settings: %s", strings.Join(parts, " "))
+}
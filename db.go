@@ -1,24 +1,184 @@
 package main
 
 import (
+	"cmp"
 	"crypto/rand"
 	"database/sql"
 	"fmt"
 	"log"
 	"math/big"
 	"regexp"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 var (
-	db        *sql.DB
+	db        *sqlDB
 	validCode = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
 )
 
+// routeCodes are the first path segments of the UI, internal and public API
+// host routes. A link with one of these codes would be shadowed there.
+var routeCodes = []string{
+	"admin", "available", "badge", "check-urls", "embed", "export", "healthz", "hook",
+	"import", "login", "logout", "metrics", "oembed", "og-image", "ogimg",
+	"pass", "preview", "qr", "readyz", "redirect-types", "settings",
+	"shorten", "static", "stats", "tokens", "trash", "urls",
+}
+
+// blockedCode reports whether a custom code is refused: the health check
+// paths (see healthPaths), a reserved code, or a match of CODE_BLOCK_REGEX.
+// Use (?i) in the pattern for case-insensitive matching.
+func blockedCode(code string) bool {
+	if _, ok := healthPaths["/"+code]; ok {
+		return true
+	}
+	if reservedCode(code) {
+		return true
+	}
+	return codeBlockRegex != nil && codeBlockRegex.MatchString(code)
+}
+
+// reservedCode reports whether code is, in any case, one of routeCodes or
+// RESERVED_CODES.
+func reservedCode(code string) bool {
+	eq := func(r string) bool { return strings.EqualFold(r, code) }
+	return slices.ContainsFunc(routeCodes, eq) || slices.ContainsFunc(reservedCodes, eq)
+}
+
+// dialect isolates the SQL differences between supported database backends.
+// All queries in this package are written with ?-style placeholders and
+// portable SQL; the dialect only handles what genuinely differs. SQLite is
+// always compiled in, other backends register themselves from build-tagged
+// files (see db_postgres.go).
+type dialect interface {
+	// driverName is the database/sql driver name to open.
+	driverName() string
+	// dsn adds per-connection options to the configured DSN.
+	dsn(dsn string) string
+	// rebind rewrites ? placeholders into the backend's native form.
+	rebind(query string) string
+	// configure runs backend-specific setup right after opening.
+	configure(db *sql.DB) error
+	// schemaVersion returns the number of migrations already applied.
+	schemaVersion(db *sql.DB) (int, error)
+	// setSchemaVersion records the schema version inside a migration tx.
+	setSchemaVersion(tx *sql.Tx, version int) error
+	// isUniqueViolation reports whether err is a primary key/unique conflict.
+	isUniqueViolation(err error) bool
+	// serialKey is the column definition of an auto-increment integer
+	// primary key, substituted for {{serial}} in migrations.
+	serialKey() string
+}
+
+var dialects = map[string]dialect{"sqlite": sqliteDialect{}}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) driverName() string { return "sqlite" }
+
+// dsn sets busy_timeout and foreign_keys through the driver's _pragma
+// parameters: unlike journal_mode they are per connection, so a one-off
+// PRAGMA statement would only reach one connection of the pool.
+func (sqliteDialect) dsn(dsn string) string {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%s_pragma=busy_timeout(%d)&_pragma=foreign_keys(1)", dsn, sep, sqliteBusyTimeout.Milliseconds())
+}
+
+func (sqliteDialect) rebind(query string) string { return query }
+
+func (sqliteDialect) configure(db *sql.DB) error {
+	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+		return fmt.Errorf("set WAL mode: %w", err)
+	}
+	var busyTimeout, foreignKeys int
+	if err := db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout); err != nil {
+		return fmt.Errorf("read busy_timeout: %w", err)
+	}
+	if err := db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		return fmt.Errorf("read foreign_keys: %w", err)
+	}
+	log.Printf("db: sqlite journal_mode=wal busy_timeout=%dms foreign_keys=%d", busyTimeout, foreignKeys)
+	return nil
+}
+
+func (sqliteDialect) schemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+func (sqliteDialect) setSchemaVersion(tx *sql.Tx, version int) error {
+	// PRAGMA user_version cannot be set via a parameterised query
+	_, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version))
+	return err
+}
+
+func (sqliteDialect) isUniqueViolation(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+func (sqliteDialect) serialKey() string { return "INTEGER PRIMARY KEY AUTOINCREMENT" }
+
+// sqlDB wraps *sql.DB so every query is rebound for the active dialect.
+type sqlDB struct {
+	*sql.DB
+	d dialect
+}
+
+func (s *sqlDB) Exec(query string, args ...any) (sql.Result, error) {
+	return s.DB.Exec(s.d.rebind(query), args...)
+}
+
+func (s *sqlDB) Query(query string, args ...any) (*sql.Rows, error) {
+	return s.DB.Query(s.d.rebind(query), args...)
+}
+
+func (s *sqlDB) QueryRow(query string, args ...any) *sql.Row {
+	return s.DB.QueryRow(s.d.rebind(query), args...)
+}
+
+func (s *sqlDB) Begin() (*sqlTx, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{Tx: tx, d: s.d}, nil
+}
+
+// sqlTx is the transaction counterpart of sqlDB.
+type sqlTx struct {
+	*sql.Tx
+	d dialect
+}
+
+func (t *sqlTx) Exec(query string, args ...any) (sql.Result, error) {
+	return t.Tx.Exec(t.d.rebind(query), args...)
+}
+
+func (t *sqlTx) Query(query string, args ...any) (*sql.Rows, error) {
+	return t.Tx.Query(t.d.rebind(query), args...)
+}
+
+func (t *sqlTx) QueryRow(query string, args ...any) *sql.Row {
+	return t.Tx.QueryRow(t.d.rebind(query), args...)
+}
+
+// isUniqueViolation reports whether err is a duplicate-key error from the active backend.
+func isUniqueViolation(err error) bool {
+	return err != nil && db.d.isUniqueViolation(err)
+}
+
 // migrations is an ordered list of statement batches, one batch per schema version.
 // Index 0 = migration to version 1, index 1 = migration to version 2, etc.
-// Never edit existing entries — only append new ones.
+// Never edit existing entries — only append new ones. Statements must stay
+// portable across every registered dialect; {{serial}} stands for the
+// dialect's auto-increment primary key (see dialect.serialKey).
 var migrations = [][]string{
 	// v1: initial schema
 	{`CREATE TABLE IF NOT EXISTS urls (
@@ -51,22 +211,140 @@ var migrations = [][]string{
 		`ALTER TABLE urls ADD COLUMN max_uses  INTEGER NOT NULL DEFAULT 0`,
 		`ALTER TABLE urls ADD COLUMN use_count INTEGER NOT NULL DEFAULT 0`,
 	},
+	// v8: per-request redirect outcomes for analytics
+	{
+		`CREATE TABLE IF NOT EXISTS clicks (
+		code       TEXT NOT NULL,
+		clicked_at TEXT NOT NULL,
+		outcome    TEXT NOT NULL
+	)`,
+		`CREATE INDEX IF NOT EXISTS idx_clicks_code ON clicks (code, clicked_at)`,
+	},
+	// v9: per-link Cache-Control override for redirects (-1 = global default)
+	{`ALTER TABLE urls ADD COLUMN cache_ttl INTEGER NOT NULL DEFAULT -1`},
+	// v10: per-link opt-out of click recording
+	{`ALTER TABLE urls ADD COLUMN no_analytics INTEGER NOT NULL DEFAULT 0`},
+	// v11: comma-separated tags (see tagList)
+	{`ALTER TABLE urls ADD COLUMN tags TEXT NOT NULL DEFAULT ''`},
+	// v12: set once the expiry notifier has announced the current expires_at
+	{`ALTER TABLE urls ADD COLUMN expiry_notified INTEGER NOT NULL DEFAULT 0`},
+	// v13: destination page title, fetched once (see fetchTitle)
+	{`ALTER TABLE urls ADD COLUMN title TEXT NOT NULL DEFAULT ''`},
+	// v14: file name of an uploaded og:image in OG_IMAGE_DIR (see ogimage.go)
+	{`ALTER TABLE urls ADD COLUMN og_image_file TEXT NOT NULL DEFAULT ''`},
+	// v15: request details per click; ip_hash is sha256 of the client IP
+	{
+		`ALTER TABLE clicks ADD COLUMN referer    TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE clicks ADD COLUMN user_agent TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE clicks ADD COLUMN ip_hash    TEXT NOT NULL DEFAULT ''`,
+	},
+	// v16: how password_hash was made; rows from before bcrypt are sha256
+	// and are rehashed on their next successful unlock
+	{`ALTER TABLE urls ADD COLUMN password_algo TEXT NOT NULL DEFAULT 'sha256'`},
+	// v17: time of the last successful redirect; empty until the first one
+	{`ALTER TABLE urls ADD COLUMN last_accessed_at TEXT NOT NULL DEFAULT ''`},
+	// v18: HTTP status of plain redirects (301, 302, 307 or 308)
+	{`ALTER TABLE urls ADD COLUMN redirect_status INTEGER NOT NULL DEFAULT 302`},
+	// v19: UTM parameters added to the destination at redirect time
+	{
+		`ALTER TABLE urls ADD COLUMN utm_source   TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE urls ADD COLUMN utm_medium   TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE urls ADD COLUMN utm_campaign TEXT NOT NULL DEFAULT ''`,
+	},
+	// v20: app links tried by the applink redirect type before long_url
+	{
+		`ALTER TABLE urls ADD COLUMN ios_url     TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE urls ADD COLUMN android_url TEXT NOT NULL DEFAULT ''`,
+	},
+	// v21: look up links by destination for /shorten reuse
+	{`CREATE INDEX IF NOT EXISTS idx_urls_long_url ON urls (long_url)`},
+	// v22: the default list order and the expiry scans
+	{
+		`CREATE INDEX IF NOT EXISTS idx_urls_created_at ON urls (created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_urls_expires_at ON urls (expires_at)`,
+	},
+	// v23: API tokens for scripts (only the sha256 of each token is kept)
+	{`CREATE TABLE IF NOT EXISTS tokens (
+		id         TEXT PRIMARY KEY,
+		token_hash TEXT NOT NULL UNIQUE,
+		label      TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		last_used  TEXT NOT NULL DEFAULT ''
+	)`},
+	// v24: prompt shown above the password input of js redirects
+	{`ALTER TABLE urls ADD COLUMN password_hint TEXT NOT NULL DEFAULT ''`},
+	// v25: forward the path below the code to the destination
+	{`ALTER TABLE urls ADD COLUMN path_forward INTEGER NOT NULL DEFAULT 0`},
+	// v26: per-link change history for GET /urls/{code}/history
+	{
+		`CREATE TABLE IF NOT EXISTS audit_log (
+		code       TEXT NOT NULL,
+		action     TEXT NOT NULL,
+		old_value  TEXT NOT NULL DEFAULT '',
+		new_value  TEXT NOT NULL DEFAULT '',
+		actor      TEXT NOT NULL DEFAULT '',
+		changed_at TEXT NOT NULL
+	)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_code ON audit_log (code, changed_at)`,
+	},
+	// v27: created_at as RFC3339 UTC instead of "2006-01-02 15:04:05" UTC
+	{`UPDATE urls SET created_at = replace(created_at, ' ', 'T') || 'Z' WHERE created_at LIKE '____-__-__ __:__:__'`},
+	// v28: soft delete; '' for live links, else when the link was moved to the trash
+	{`ALTER TABLE urls ADD COLUMN deleted_at TEXT NOT NULL DEFAULT ''`},
+	// v29: expire after a period without redirects (Go duration, '' = never)
+	{`ALTER TABLE urls ADD COLUMN expire_after_idle TEXT NOT NULL DEFAULT ''`},
+	// v30: merge the request's query string into the destination's
+	{`ALTER TABLE urls ADD COLUMN forward_query INTEGER NOT NULL DEFAULT 0`},
+	// v31: the remaining "2006-01-02 15:04:05" UTC timestamps as RFC3339 UTC, like v27
+	{
+		`UPDATE urls SET last_accessed_at = replace(last_accessed_at, ' ', 'T') || 'Z' WHERE last_accessed_at LIKE '____-__-__ __:__:__'`,
+		`UPDATE tokens SET created_at = replace(created_at, ' ', 'T') || 'Z' WHERE created_at LIKE '____-__-__ __:__:__'`,
+		`UPDATE tokens SET last_used = replace(last_used, ' ', 'T') || 'Z' WHERE last_used LIKE '____-__-__ __:__:__'`,
+		`UPDATE audit_log SET changed_at = replace(changed_at, ' ', 'T') || 'Z' WHERE changed_at LIKE '____-__-__ __:__:__'`,
+	},
+	// v32: audit_log id, so entries written in the same second keep their order
+	{
+		`CREATE TABLE audit_log_new (
+		id         {{serial}},
+		code       TEXT NOT NULL,
+		action     TEXT NOT NULL,
+		old_value  TEXT NOT NULL DEFAULT '',
+		new_value  TEXT NOT NULL DEFAULT '',
+		actor      TEXT NOT NULL DEFAULT '',
+		changed_at TEXT NOT NULL
+	)`,
+		`INSERT INTO audit_log_new (code, action, old_value, new_value, actor, changed_at)
+		SELECT code, action, old_value, new_value, actor, changed_at FROM audit_log ORDER BY changed_at`,
+		`DROP TABLE audit_log`,
+		`ALTER TABLE audit_log_new RENAME TO audit_log`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_code ON audit_log (code, changed_at)`,
+	},
+	// v33: query parameters a template link requires/allows (JSON, '' = any)
+	{`ALTER TABLE urls ADD COLUMN param_spec TEXT NOT NULL DEFAULT ''`},
 }
 
 func initDB() error {
-	var err error
-	db, err = sql.Open("sqlite", dbFile)
+	d, ok := dialects[dbDriver]
+	if !ok {
+		return fmt.Errorf("unsupported DB_DRIVER %q (is it compiled in? e.g. -tags %s)", dbDriver, dbDriver)
+	}
+	dsn := dbDSN
+	if dsn == "" {
+		dsn = dbFile
+	}
+	conn, err := sql.Open(d.driverName(), d.dsn(dsn))
 	if err != nil {
 		return err
 	}
+	db = &sqlDB{DB: conn, d: d}
 
-	if _, err = db.Exec("PRAGMA journal_mode=WAL"); err != nil {
-		return fmt.Errorf("set WAL mode: %w", err)
+	if err = d.configure(conn); err != nil {
+		return err
 	}
 
-	var version int
-	if err = db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
-		return fmt.Errorf("read user_version: %w", err)
+	version, err := d.schemaVersion(conn)
+	if err != nil {
+		return fmt.Errorf("read schema version: %w", err)
 	}
 
 	for i, stmts := range migrations[version:] {
@@ -87,12 +365,12 @@ func applyMigration(targetVersion int, stmts []string) error {
 	defer tx.Rollback()
 
 	for _, stmt := range stmts {
+		stmt = strings.ReplaceAll(stmt, "{{serial}}", db.d.serialKey())
 		if _, err = tx.Exec(stmt); err != nil {
 			return err
 		}
 	}
-	// PRAGMA user_version cannot be set via a parameterised query
-	if _, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", targetVersion)); err != nil {
+	if err = db.d.setSchemaVersion(tx.Tx, targetVersion); err != nil {
 		return err
 	}
 	return tx.Commit()
@@ -105,8 +383,15 @@ func boolToInt(b bool) int {
 	return 0
 }
 
-func generateCode() (string, error) {
-	code := make([]byte, codeLen)
+// generateCode returns a random code for the given number of collisions
+// already hit while generating it: codeLen characters, plus one for every
+// codeGrowAfter collisions, so a crowded keyspace is left behind.
+func generateCode(collisions int) (string, error) {
+	n := codeLen
+	if codeGrowAfter > 0 {
+		n = min(codeLen+collisions/codeGrowAfter, 32-boolToInt(codeChecksum))
+	}
+	code := make([]byte, n)
 	for i := range code {
 		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
 		if err != nil {
@@ -114,72 +399,333 @@ func generateCode() (string, error) {
 		}
 		code[i] = charset[n.Int64()]
 	}
+	if codeChecksum {
+		code = append(code, checksumChar(string(code)))
+	}
 	return string(code), nil
 }
 
 type urlRecord struct {
-	LongURL         string
-	PublicEnabled   bool
-	InternalEnabled bool
-	RedirectType    string
-	OGTitle         string
-	OGDescription   string
-	OGImage         string
-	PasswordHash    string
-	Description     string
-	ExpiresAt       string
-	MaxUses         int
-	UseCount        int
-}
-
-// URLRow is used to render the URL list in the template.
+	LongURL         string    `json:"long_url"`
+	PublicEnabled   bool      `json:"public_enabled"`
+	InternalEnabled bool      `json:"internal_enabled"`
+	RedirectType    string    `json:"redirect_type"`
+	OGTitle         string    `json:"og_title"`
+	OGDescription   string    `json:"og_description"`
+	OGImage         string    `json:"og_image"`
+	PasswordHash    string    `json:"-"`
+	Description     string    `json:"description"`
+	ExpiresAt       string    `json:"expires_at"`
+	MaxUses         int       `json:"max_uses"`
+	UseCount        int       `json:"use_count"`
+	CacheTTL        int       `json:"cache_ttl"`    // seconds; -1 = use REDIRECT_CACHE_TTL, 0 = no-store
+	NoAnalytics     bool      `json:"no_analytics"` // skip the clicks table for this code
+	Tags            tagList   `json:"tags"`
+	Title           string    `json:"title"` // destination <title>; empty until fetched
+	OGImageFile     string    `json:"-"`
+	PasswordAlgo    string    `json:"-"`               // passwordAlgoBcrypt, or passwordAlgoSHA256 for old rows
+	RedirectStatus  int       `json:"redirect_status"` // used when RedirectType is "redirect"
+	UTMSource       string    `json:"utm_source"`
+	UTMMedium       string    `json:"utm_medium"`
+	UTMCampaign     string    `json:"utm_campaign"`
+	IOSURL          string    `json:"ios_url"`     // app link for iOS; applink redirects only
+	AndroidURL      string    `json:"android_url"` // app link for Android; applink redirects only
+	PasswordHint    string    `json:"password_hint"`
+	PathForward     bool      `json:"path_forward"`      // append the path below the code to long_url
+	ExpireAfterIdle string    `json:"expire_after_idle"` // Go duration without redirects after which the link expires
+	ForwardQuery    bool      `json:"forward_query"`     // merge the request's query parameters into long_url's
+	ParamSpec       paramSpec `json:"param_spec"`        // query parameters a template link takes; see paramSpec
+}
+
+// recordColumns are the urls columns backing urlRecord, in scanTargets order.
+const recordColumns = "long_url, public_enabled, internal_enabled, redirect_type, og_title, og_description, og_image, password_hash, description, expires_at, max_uses, use_count, cache_ttl, no_analytics, tags, title, og_image_file, password_algo, redirect_status, utm_source, utm_medium, utm_campaign, ios_url, android_url, password_hint, path_forward, expire_after_idle, forward_query, param_spec"
+
+func (r *urlRecord) scanTargets() []any {
+	return []any{&r.LongURL, &r.PublicEnabled, &r.InternalEnabled, &r.RedirectType, &r.OGTitle, &r.OGDescription, &r.OGImage, &r.PasswordHash, &r.Description, &r.ExpiresAt, &r.MaxUses, &r.UseCount, &r.CacheTTL, &r.NoAnalytics, &r.Tags, &r.Title, &r.OGImageFile, &r.PasswordAlgo, &r.RedirectStatus, &r.UTMSource, &r.UTMMedium, &r.UTMCampaign, &r.IOSURL, &r.AndroidURL, &r.PasswordHint, &r.PathForward, &r.ExpireAfterIdle, &r.ForwardQuery, &r.ParamSpec}
+}
+
+// URLRow is used to render the URL list in the template and the JSON list.
 type URLRow struct {
-	Code            string
-	LongURL         string
-	PublicEnabled   bool
-	InternalEnabled bool
-	RedirectType    string
-	OGTitle         string
-	OGDescription   string
-	OGImage         string
-	HasPassword     bool
-	Description     string
-	CreatedAt       string
-	ExpiresAt       string
-	IsExpired       bool
-	MaxUses         int
-	UseCount        int
-	UsesExhausted   bool
-}
-
-func saveURL(code, longURL string, publicEnabled, internalEnabled bool, redirectType, ogTitle, ogDescription, ogImage, passwordHash, description, expiresAt string, maxUses int) error {
-	_, err := db.Exec(
-		`INSERT INTO urls (code, long_url, public_enabled, internal_enabled, redirect_type, og_title, og_description, og_image, password_hash, description, expires_at, max_uses, created_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		code, longURL, boolToInt(publicEnabled), boolToInt(internalEnabled),
-		redirectType, ogTitle, ogDescription, ogImage, passwordHash, description, expiresAt, maxUses,
-		time.Now().UTC().Format("2006-01-02 15:04:05"),
+	Code string `json:"code"`
+	urlRecord
+	HasPassword     bool   `json:"has_password"`
+	HasOGUpload     bool   `json:"has_og_image_upload"`
+	CreatedAt       string `json:"created_at"`            // RFC3339, UTC
+	CreatedDisplay  string `json:"created_display"`       // created_at in the display timezone
+	ExpiresDisplay  string `json:"expires_display"`       // expires_at likewise; empty if none
+	LastAccessedAt  string `json:"last_accessed_at"`      // RFC3339, UTC; empty if never used
+	AccessedDisplay string `json:"last_accessed_display"` // last_accessed_at in the display timezone
+	IdleExpired     bool   `json:"idle_expired"`          // unused for longer than expire_after_idle
+	DeletedAt       string `json:"deleted_at,omitempty"`  // set only for links in the trash
+	Clicks          int    `json:"clicks"`                // recorded successful redirects
+	IsExpired       bool   `json:"is_expired"`
+	UsesExhausted   bool   `json:"uses_exhausted"`
+}
+
+// dataVersion is bumped on every write to the urls table (including
+// last_accessed_at) and every recorded click. Together with bootID it gives list endpoints a cheap change marker for ETags without
+// serializing the rows. It is per-process: other instances sharing the same
+// database produce different ETags, which only costs an extra full response.
+var (
+	dataVersion atomic.Int64
+	bootID      = time.Now().UnixNano()
+)
+
+func markChanged() { dataVersion.Add(1) }
+
+// execer is satisfied by both *sqlDB and *sqlTx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func saveURL(code string, rec urlRecord) error {
+	err := insertURL(db, code, rec)
+	if err == nil {
+		markChanged()
+	}
+	return err
+}
+
+// insertURL is saveURL on any execer; callers in a transaction call
+// markChanged once it commits.
+func insertURL(ex execer, code string, rec urlRecord) error {
+	_, err := ex.Exec(
+		`INSERT INTO urls (code, long_url, public_enabled, internal_enabled, redirect_type, og_title, og_description, og_image, password_hash, description, expires_at, max_uses, cache_ttl, no_analytics, tags, title, og_image_file, password_algo, redirect_status, utm_source, utm_medium, utm_campaign, ios_url, android_url, password_hint, path_forward, expire_after_idle, forward_query, param_spec, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		code, rec.LongURL, boolToInt(rec.PublicEnabled), boolToInt(rec.InternalEnabled),
+		rec.RedirectType, rec.OGTitle, rec.OGDescription, rec.OGImage, rec.PasswordHash, rec.Description, rec.ExpiresAt, rec.MaxUses, rec.CacheTTL, boolToInt(rec.NoAnalytics), rec.Tags, rec.Title, rec.OGImageFile, cmp.Or(rec.PasswordAlgo, passwordAlgoBcrypt), cmp.Or(rec.RedirectStatus, defaultRedirectStatus), rec.UTMSource, rec.UTMMedium, rec.UTMCampaign, rec.IOSURL, rec.AndroidURL, rec.PasswordHint, boolToInt(rec.PathForward), rec.ExpireAfterIdle, boolToInt(rec.ForwardQuery), rec.ParamSpec,
+		time.Now().UTC().Format(time.RFC3339),
 	)
 	return err
 }
 
+// insertURLSavepoint inserts rec under code, or a generated code when code
+// is empty, inside a savepoint so a failure leaves tx usable (on Postgres any
+// failed statement would otherwise abort it). It returns the code it tried
+// last.
+func insertURLSavepoint(tx *sqlTx, code string, rec urlRecord) (string, error) {
+	generate := code == ""
+	for collisions := 0; ; collisions++ {
+		if generate {
+			var err error
+			if code, err = generateCode(collisions); err != nil {
+				return "", err
+			}
+		}
+		if _, err := tx.Exec("SAVEPOINT insert_url"); err != nil {
+			return code, err
+		}
+		err := insertURL(tx, code, rec)
+		if err == nil {
+			_, err = tx.Exec("RELEASE SAVEPOINT insert_url")
+			return code, err
+		}
+		if _, rbErr := tx.Exec("ROLLBACK TO SAVEPOINT insert_url"); rbErr != nil {
+			return code, rbErr
+		}
+		if !generate || !isUniqueViolation(err) {
+			return code, err
+		}
+	}
+}
+
+// saveURLGenerated stores rec under a fresh random code, retrying on collisions.
+func saveURLGenerated(rec urlRecord) (string, error) {
+	for collisions := 0; ; collisions++ {
+		code, err := generateCode(collisions)
+		if err != nil {
+			return "", err
+		}
+		if err := saveURL(code, rec); !isUniqueViolation(err) {
+			return code, err
+		}
+	}
+}
+
+// getRecord loads a live link; links in the trash are sql.ErrNoRows.
 func getRecord(code string) (urlRecord, error) {
 	var r urlRecord
-	var pub, int_ int
-	err := db.QueryRow(
-		`SELECT long_url, public_enabled, internal_enabled, redirect_type, og_title, og_description, og_image, password_hash, description, expires_at, max_uses, use_count
-		 FROM urls WHERE code = ?`, code,
-	).Scan(&r.LongURL, &pub, &int_, &r.RedirectType, &r.OGTitle, &r.OGDescription, &r.OGImage, &r.PasswordHash, &r.Description, &r.ExpiresAt, &r.MaxUses, &r.UseCount)
-	r.PublicEnabled = pub == 1
-	r.InternalEnabled = int_ == 1
+	err := db.QueryRow("SELECT "+recordColumns+" FROM urls WHERE code = ? AND "+liveLink, code).Scan(r.scanTargets()...)
 	return r, err
 }
 
+// codeExists reports whether code is taken, by a live or a trashed link.
+func codeExists(code string) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM urls WHERE code = ?", code).Scan(&n)
+	return n > 0, err
+}
+
+// rowColumns selects everything needed to build a URLRow via scanRow,
+// including the number of successful redirects from the clicks table.
+const rowColumns = "code, " + recordColumns + ", created_at, last_accessed_at, deleted_at, " +
+	"(SELECT COUNT(*) FROM clicks WHERE clicks.code = urls.code AND clicks.outcome = '" + outcomeRedirected + "')"
+
+// scanRow scans a rowColumns result and fills in the derived fields.
+func scanRow(sc interface{ Scan(...any) error }) (URLRow, error) {
+	var r URLRow
+	dest := append([]any{&r.Code}, r.scanTargets()...)
+	if err := sc.Scan(append(dest, &r.CreatedAt, &r.LastAccessedAt, &r.DeletedAt, &r.Clicks)...); err != nil {
+		return r, err
+	}
+	r.CreatedAt = storedTime(r.CreatedAt)
+	r.localize(displayLocation())
+	r.HasPassword = r.PasswordHash != ""
+	r.HasOGUpload = r.OGImageFile != ""
+	if r.ExpiresAt != "" {
+		if t, err := time.Parse(time.RFC3339, r.ExpiresAt); err == nil {
+			r.IsExpired = time.Now().UTC().After(t)
+		}
+	}
+	r.IdleExpired = idleExpired(r.ExpireAfterIdle, r.CreatedAt, r.LastAccessedAt)
+	r.IsExpired = r.IsExpired || r.IdleExpired
+	r.UsesExhausted = r.MaxUses > 0 && r.UseCount >= r.MaxUses
+	return r, nil
+}
+
+// getURLRow is getRecord plus the code, created_at and derived fields.
+func getURLRow(code string) (URLRow, error) {
+	return scanRow(db.QueryRow("SELECT "+rowColumns+" FROM urls WHERE code = ? AND "+liveLink, code))
+}
+
+// findReusableURL returns the oldest live link to rec's destination with the
+// same enabled flags and no password, for POST /shorten reuse.
+func findReusableURL(rec urlRecord) (URLRow, bool, error) {
+	rows, err := queryURLs("SELECT "+rowColumns+" FROM urls WHERE "+liveLink+" AND long_url = ? AND public_enabled = ? AND internal_enabled = ? AND password_hash = '' ORDER BY created_at, code",
+		rec.LongURL, boolToInt(rec.PublicEnabled), boolToInt(rec.InternalEnabled))
+	if err != nil {
+		return URLRow{}, false, err
+	}
+	for _, r := range rows {
+		if !r.IsExpired && !r.UsesExhausted {
+			return r, true, nil
+		}
+	}
+	return URLRow{}, false, nil
+}
+
 func getAllURLs() ([]URLRow, error) {
-	rows, err := db.Query(
-		`SELECT code, long_url, public_enabled, internal_enabled, redirect_type, og_title, og_description, og_image, password_hash, description, expires_at, max_uses, use_count, created_at
-		 FROM urls ORDER BY created_at DESC`,
-	)
+	return queryURLs("SELECT " + rowColumns + " FROM urls WHERE " + liveLink + " ORDER BY created_at DESC")
+}
+
+// getExpiringURLs returns links that are still live but expire within the
+// given window, soonest first. expires_at may carry any RFC3339 offset, so
+// the window is applied in Go rather than by comparing strings in SQL.
+func getExpiringURLs(within time.Duration) ([]URLRow, error) {
+	all, err := queryURLs("SELECT " + rowColumns + " FROM urls WHERE " + liveLink + " AND expires_at != ''")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	type expiring struct {
+		row URLRow
+		at  time.Time
+	}
+	var hits []expiring
+	for _, r := range all {
+		t, err := time.Parse(time.RFC3339, r.ExpiresAt)
+		if err != nil || !t.After(now) || t.Sub(now) > within {
+			continue
+		}
+		hits = append(hits, expiring{r, t})
+	}
+	slices.SortFunc(hits, func(a, b expiring) int { return a.at.Compare(b.at) })
+	urls := make([]URLRow, len(hits))
+	for i, h := range hits {
+		urls[i] = h.row
+	}
+	return urls, nil
+}
+
+// urlListQuery selects a sorted page of the URL list. Limit 0 means no limit.
+type urlListQuery struct {
+	Search         string        // case-insensitive substring of code, long_url or description
+	Tag            string        // exact tag, already normalized
+	ExpiringWithin time.Duration // links expiring this soon (see getExpiringURLs); 0 = all
+	Sort           string        // a key of urlSortColumns; default created_at
+	Desc           bool
+	Limit          int
+	Offset         int
+}
+
+// urlSortColumns are the columns GET /urls can sort by. Never-used links
+// have an empty last_accessed_at and so sort as the least recently used.
+var urlSortColumns = map[string]string{
+	"created_at":       "created_at",
+	"code":             "code",
+	"use_count":        "use_count",
+	"last_accessed_at": "last_accessed_at",
+}
+
+// likeEscaper escapes LIKE wildcards so a search term matches literally;
+// queries using it declare ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// listURLs returns one page of links plus the number of links matching the
+// search and tag filters (all links when there are none).
+func listURLs(q urlListQuery) ([]URLRow, int, error) {
+	conds := []string{liveLink}
+	var args []any
+	if q.Search != "" {
+		// LOWER on both sides: SQLite's LIKE ignores ASCII case, Postgres' doesn't.
+		pat := "%" + likeEscaper.Replace(strings.ToLower(q.Search)) + "%"
+		conds = append(conds, `(LOWER(code) LIKE ? ESCAPE '\' OR LOWER(long_url) LIKE ? ESCAPE '\' OR LOWER(description) LIKE ? ESCAPE '\')`)
+		args = append(args, pat, pat, pat)
+	}
+	if q.Tag != "" {
+		// validTag excludes LIKE wildcards, so the tag needs no escaping
+		conds = append(conds, "',' || tags || ',' LIKE ?")
+		args = append(args, "%,"+q.Tag+",%")
+	}
+	if q.ExpiringWithin > 0 {
+		// expires_at keeps its original offset, so compare times in Go.
+		soon, err := getExpiringURLs(q.ExpiringWithin)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(soon) == 0 {
+			return []URLRow{}, 0, nil
+		}
+		marks := make([]string, len(soon))
+		for i, u := range soon {
+			marks[i] = "?"
+			args = append(args, u.Code)
+		}
+		conds = append(conds, "code IN ("+strings.Join(marks, ", ")+")")
+	}
+	where := " WHERE " + strings.Join(conds, " AND ")
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM urls"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	col, ok := urlSortColumns[q.Sort]
+	if !ok {
+		col = "created_at"
+	}
+	dir := "ASC"
+	if q.Desc {
+		dir = "DESC"
+	}
+	// code breaks ties so pages never overlap or skip rows
+	query := "SELECT " + rowColumns + " FROM urls" + where + " ORDER BY " + col + " " + dir + ", code " + dir
+	if q.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, q.Limit, q.Offset)
+	}
+	urls, err := queryURLs(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	if q.Limit <= 0 && q.Offset > 0 {
+		// OFFSET without LIMIT isn't portable SQL; skip in Go instead.
+		urls = urls[min(q.Offset, len(urls)):]
+	}
+	return urls, total, nil
+}
+
+// queryURLs runs a SELECT of rowColumns and scans every row.
+func queryURLs(query string, args ...any) ([]URLRow, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -187,83 +733,202 @@ func getAllURLs() ([]URLRow, error) {
 
 	var urls []URLRow
 	for rows.Next() {
-		var r URLRow
-		var pub, int_ int
-		var passwordHash string
-		if err := rows.Scan(&r.Code, &r.LongURL, &pub, &int_, &r.RedirectType, &r.OGTitle, &r.OGDescription, &r.OGImage, &passwordHash, &r.Description, &r.ExpiresAt, &r.MaxUses, &r.UseCount, &r.CreatedAt); err != nil {
+		r, err := scanRow(rows)
+		if err != nil {
 			return nil, err
 		}
-		r.PublicEnabled = pub == 1
-		r.InternalEnabled = int_ == 1
-		r.HasPassword = passwordHash != ""
-		if r.ExpiresAt != "" {
-			if t, err := time.Parse(time.RFC3339, r.ExpiresAt); err == nil {
-				r.IsExpired = time.Now().UTC().After(t)
-			}
-		}
-		r.UsesExhausted = r.MaxUses > 0 && r.UseCount >= r.MaxUses
 		urls = append(urls, r)
 	}
 	return urls, rows.Err()
 }
 
-func updateURL(code string, longURL *string, publicEnabled, internalEnabled *bool, redirectType, ogTitle, ogDescription, ogImage, passwordHash, description, expiresAt *string, maxUses *int) error {
+// urlPatch is a partial update of a urls row; nil fields are left unchanged.
+type urlPatch struct {
+	LongURL         *string
+	PublicEnabled   *bool
+	InternalEnabled *bool
+	RedirectType    *string
+	RedirectStatus  *int
+	UTMSource       *string
+	UTMMedium       *string
+	UTMCampaign     *string
+	IOSURL          *string
+	AndroidURL      *string
+	PasswordHint    *string
+	PathForward     *bool
+	ExpireAfterIdle *string
+	ForwardQuery    *bool
+	ParamSpec       *paramSpec
+	OGTitle         *string
+	OGDescription   *string
+	OGImage         *string
+	PasswordHash    *string
+	Description     *string
+	ExpiresAt       *string
+	MaxUses         *int
+	CacheTTL        *int
+	NoAnalytics     *bool
+	Tags            *tagList
+	OGImageFile     *string
+}
+
+// updateURL applies p to code's row. On db it also marks the change and
+// drops the cached record; callers in a transaction do that once it
+// commits, so a concurrent redirect cannot re-cache the old row.
+func updateURL(ex execer, code string, p urlPatch) error {
 	var sets []string
 	var args []any
+	set := func(col string, v any) {
+		sets = append(sets, col+" = ?")
+		args = append(args, v)
+	}
 
-	if longURL != nil {
-		sets = append(sets, "long_url = ?")
-		args = append(args, *longURL)
+	if p.LongURL != nil {
+		// The stored title belongs to the old destination; SET expressions see
+		// the pre-update row, so this only clears it when the URL changes.
+		sets = append(sets, "title = CASE WHEN long_url = ? THEN title ELSE '' END")
+		args = append(args, *p.LongURL)
+		set("long_url", *p.LongURL)
+	}
+	if p.PublicEnabled != nil {
+		set("public_enabled", boolToInt(*p.PublicEnabled))
+	}
+	if p.InternalEnabled != nil {
+		set("internal_enabled", boolToInt(*p.InternalEnabled))
+	}
+	if p.RedirectType != nil {
+		set("redirect_type", *p.RedirectType)
+	}
+	if p.RedirectStatus != nil {
+		set("redirect_status", *p.RedirectStatus)
+	}
+	if p.UTMSource != nil {
+		set("utm_source", *p.UTMSource)
+	}
+	if p.UTMMedium != nil {
+		set("utm_medium", *p.UTMMedium)
+	}
+	if p.UTMCampaign != nil {
+		set("utm_campaign", *p.UTMCampaign)
+	}
+	if p.IOSURL != nil {
+		set("ios_url", *p.IOSURL)
+	}
+	if p.AndroidURL != nil {
+		set("android_url", *p.AndroidURL)
+	}
+	if p.PasswordHint != nil {
+		set("password_hint", *p.PasswordHint)
+	}
+	if p.PathForward != nil {
+		set("path_forward", boolToInt(*p.PathForward))
+	}
+	if p.ExpireAfterIdle != nil {
+		set("expire_after_idle", *p.ExpireAfterIdle)
+	}
+	if p.ForwardQuery != nil {
+		set("forward_query", boolToInt(*p.ForwardQuery))
 	}
-	if publicEnabled != nil {
-		sets = append(sets, "public_enabled = ?")
-		args = append(args, boolToInt(*publicEnabled))
+	if p.ParamSpec != nil {
+		set("param_spec", *p.ParamSpec)
 	}
-	if internalEnabled != nil {
-		sets = append(sets, "internal_enabled = ?")
-		args = append(args, boolToInt(*internalEnabled))
+	if p.OGTitle != nil {
+		set("og_title", *p.OGTitle)
 	}
-	if redirectType != nil {
-		sets = append(sets, "redirect_type = ?")
-		args = append(args, *redirectType)
+	if p.OGDescription != nil {
+		set("og_description", *p.OGDescription)
 	}
-	if ogTitle != nil {
-		sets = append(sets, "og_title = ?")
-		args = append(args, *ogTitle)
+	if p.OGImage != nil {
+		set("og_image", *p.OGImage)
 	}
-	if ogDescription != nil {
-		sets = append(sets, "og_description = ?")
-		args = append(args, *ogDescription)
+	if p.PasswordHash != nil {
+		set("password_hash", *p.PasswordHash)
+		set("password_algo", passwordAlgoBcrypt) // new hashes are always bcrypt
 	}
-	if ogImage != nil {
-		sets = append(sets, "og_image = ?")
-		args = append(args, *ogImage)
+	if p.Description != nil {
+		set("description", *p.Description)
 	}
-	if passwordHash != nil {
-		sets = append(sets, "password_hash = ?")
-		args = append(args, *passwordHash)
+	if p.ExpiresAt != nil {
+		set("expires_at", *p.ExpiresAt)
+		set("expiry_notified", 0) // a new expiry deserves a new heads-up
 	}
-	if description != nil {
-		sets = append(sets, "description = ?")
-		args = append(args, *description)
+	if p.MaxUses != nil {
+		set("max_uses", *p.MaxUses)
 	}
-	if expiresAt != nil {
-		sets = append(sets, "expires_at = ?")
-		args = append(args, *expiresAt)
+	if p.CacheTTL != nil {
+		set("cache_ttl", *p.CacheTTL)
 	}
-	if maxUses != nil {
-		sets = append(sets, "max_uses = ?")
-		args = append(args, *maxUses)
+	if p.NoAnalytics != nil {
+		set("no_analytics", boolToInt(*p.NoAnalytics))
+	}
+	if p.Tags != nil {
+		set("tags", *p.Tags)
+	}
+	if p.OGImageFile != nil {
+		set("og_image_file", *p.OGImageFile)
 	}
 	if len(sets) == 0 {
 		return nil
 	}
 
 	args = append(args, code)
-	_, err := db.Exec("UPDATE urls SET "+strings.Join(sets, ", ")+" WHERE code = ?", args...)
+	if _, err := ex.Exec("UPDATE urls SET "+strings.Join(sets, ", ")+" WHERE code = ?", args...); err != nil {
+		return err
+	}
+	if _, inTx := ex.(*sqlTx); !inTx {
+		markChanged()
+		forgetRecord(code)
+	}
+	return nil
+}
+
+// renameURL moves a row (and its click and audit history) to a new code. The
+// code is the primary key, so the row is copied under the new code and the
+// old one removed. The caller calls markChanged and forgetRecord for both
+// codes once tx commits.
+func renameURL(tx *sqlTx, oldCode, newCode string) error {
+	const moved = recordColumns + ", created_at, expiry_notified, last_accessed_at"
+	if _, err := tx.Exec(
+		"INSERT INTO urls (code, "+moved+") SELECT ?, "+moved+" FROM urls WHERE code = ?",
+		newCode, oldCode,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM urls WHERE code = ?", oldCode); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE clicks SET code = ? WHERE code = ?", newCode, oldCode); err != nil {
+		return err
+	}
+	_, err := tx.Exec("UPDATE audit_log SET code = ? WHERE code = ?", newCode, oldCode)
 	return err
 }
 
+// renameURLGenerated moves oldCode to a fresh generateCode code, retrying
+// under a savepoint on collisions like insertURLSavepoint, and returns it.
+func renameURLGenerated(tx *sqlTx, oldCode string) (string, error) {
+	for collisions := 0; ; collisions++ {
+		code, err := generateCode(collisions)
+		if err != nil {
+			return "", err
+		}
+		if _, err := tx.Exec("SAVEPOINT rename_url"); err != nil {
+			return "", err
+		}
+		err = renameURL(tx, oldCode, code)
+		if err == nil {
+			_, err = tx.Exec("RELEASE SAVEPOINT rename_url")
+			return code, err
+		}
+		if _, rbErr := tx.Exec("ROLLBACK TO SAVEPOINT rename_url"); rbErr != nil {
+			return "", rbErr
+		}
+		if !isUniqueViolation(err) {
+			return "", err
+		}
+	}
+}
+
 // incrementUseCount atomically increments use_count.
 // When maxUses > 0 it only increments while use_count < max_uses and returns
 // withinLimit=false (without incrementing) once the limit is reached.
@@ -278,17 +943,60 @@ func incrementUseCount(code string, maxUses int) (withinLimit bool, err error) {
 		return false, err
 	}
 	n, _ := res.RowsAffected()
+	if n > 0 {
+		markChanged()
+	}
 	return n > 0, nil
 }
 
+// touchLastAccessed stamps a successful redirect. It is best-effort: a
+// failure is logged and the redirect goes ahead.
+func touchLastAccessed(code string) {
+	if _, err := db.Exec("UPDATE urls SET last_accessed_at = ? WHERE code = ?", time.Now().UTC().Format(time.RFC3339), code); err != nil {
+		log.Printf("last_accessed_at %s: %v", code, err)
+		return
+	}
+	markChanged()
+}
+
+// deleteURL moves a live link to the trash (see trash.go). It keeps its
+// code, clicks and uploaded image until it is purged.
 func deleteURL(code string) error {
-	res, err := db.Exec("DELETE FROM urls WHERE code = ?", code)
+	res, err := db.Exec("UPDATE urls SET deleted_at = ? WHERE code = ? AND "+liveLink, time.Now().UTC().Format(time.RFC3339), code)
 	if err != nil {
 		return err
 	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
+	if n, _ := res.RowsAffected(); n == 0 {
 		return sql.ErrNoRows
 	}
+	markChanged()
+	forgetRecord(code)
 	return nil
 }
+
+// purgeURL removes a link, live or in the trash, with its clicks for good
+// and returns its og_image_file for the caller to remove.
+func purgeURL(code string) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var image string
+	if err := tx.QueryRow("SELECT og_image_file FROM urls WHERE code = ?", code).Scan(&image); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec("DELETE FROM urls WHERE code = ?", code); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec("DELETE FROM clicks WHERE code = ?", code); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	markChanged()
+	forgetRecord(code)
+	return image, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// linkCard is the public, embeddable view of a link. Destinations of
+// password-protected links and click counts of no_analytics links are never
+// included.
+type linkCard struct {
+	Code        string `json:"code"`
+	ShortURL    string `json:"short_url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Clicks      *int   `json:"clicks,omitempty"`
+}
+
+// publicCard loads code as a linkCard. Links that aren't live on the public
+// host are reported with the status a redirect would get.
+func publicCard(code string) (linkCard, int) {
+	row, err := getURLRow(code)
+	if err == sql.ErrNoRows || (err == nil && !row.PublicEnabled) {
+		return linkCard{}, http.StatusNotFound
+	} else if err != nil {
+		return linkCard{}, http.StatusInternalServerError
+	}
+	if gone, _ := linkExpiry(row.ExpiresAt); gone || row.IdleExpired || row.UsesExhausted {
+		return linkCard{}, http.StatusGone
+	}
+
+	base, _, _, _, _ := cfg.snapshot()
+	if ab := cfg.aliasBase(nil); ab != "" {
+		base = ab
+	}
+	card := linkCard{
+		Code:        code,
+		ShortURL:    base + "/" + code,
+		Title:       row.OGTitle,
+		Description: row.OGDescription,
+		Image:       row.OGImage,
+	}
+	if row.OGImageFile != "" {
+		card.Image = ogImageURL(base, code)
+	}
+	if card.Description == "" {
+		card.Description = row.Description
+	}
+	if !row.HasPassword {
+		card.Destination = row.destination()
+	}
+	if !row.NoAnalytics {
+		card.Clicks = &row.UseCount
+	}
+	return card, http.StatusOK
+}
+
+func writeEmbedJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(v)
+}
+
+// embedHandler serves GET /embed/{code}.json.
+func embedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	code, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/embed/"), ".json")
+	if !ok || !validCode.MatchString(code) {
+		http.NotFound(w, r)
+		return
+	}
+	card, status := publicCard(code)
+	if status != http.StatusOK {
+		jsonError(w, status, strings.ToLower(http.StatusText(status)))
+		return
+	}
+	writeEmbedJSON(w, card)
+}
+
+// oembedHandler serves GET /oembed?url=<short_url>, an oEmbed 1.0 "link"
+// response for short URLs on the public or alias host.
+func oembedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	if f := q.Get("format"); f != "" && f != "json" {
+		http.Error(w, "only format=json is supported", http.StatusNotImplemented)
+		return
+	}
+	u, err := url.Parse(q.Get("url"))
+	if err != nil || u.Host == "" {
+		jsonError(w, http.StatusBadRequest, "url must be a short URL")
+		return
+	}
+	pb, ph, _, _, ah := cfg.snapshot()
+	code := strings.TrimPrefix(u.Path, "/")
+	if (u.Host != ph && u.Host != hostOf(ah)) || !validCode.MatchString(code) {
+		jsonError(w, http.StatusNotFound, "not a short URL on this service")
+		return
+	}
+	card, status := publicCard(code)
+	if status != http.StatusOK {
+		jsonError(w, status, strings.ToLower(http.StatusText(status)))
+		return
+	}
+
+	resp := map[string]any{
+		"version":       "1.0",
+		"type":          "link",
+		"provider_name": ph,
+		"provider_url":  pb,
+		"title":         card.Title,
+	}
+	if card.Title == "" {
+		resp["title"] = card.ShortURL
+	}
+	if card.Description != "" {
+		resp["description"] = card.Description
+	}
+	writeEmbedJSON(w, resp)
+}
+
+// linkPreview is the GET /preview/{code} view: what a redirect would lead
+// to, without following it. Destinations of password-protected links are
+// never included.
+type linkPreview struct {
+	Code          string `json:"code"`
+	LongURL       string `json:"long_url,omitempty"`
+	OGTitle       string `json:"og_title"`
+	OGDescription string `json:"og_description"`
+	OGImage       string `json:"og_image"`
+	RedirectType  string `json:"redirect_type"`
+	HasPassword   bool   `json:"has_password"`
+	IsExpired     bool   `json:"is_expired"`
+	UsesExhausted bool   `json:"uses_exhausted"`
+}
+
+// previewHandler serves GET /preview/{code}. Like doRedirect it only shows
+// links enabled for the host it is asked on (internal links on the internal
+// host, public links elsewhere), and it never counts a use or a click.
+func previewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	code := strings.TrimPrefix(r.URL.Path, "/preview/")
+	internal := routeOf(r) == routeInternal
+	row, err := getURLRow(code)
+	if err == sql.ErrNoRows || (err == nil && internal && !row.InternalEnabled) || (err == nil && !internal && !row.PublicEnabled) {
+		jsonError(w, http.StatusNotFound, "short URL not found")
+		return
+	} else if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+
+	gone, _ := linkExpiry(row.ExpiresAt)
+	p := linkPreview{
+		Code:          code,
+		OGTitle:       row.OGTitle,
+		OGDescription: row.OGDescription,
+		OGImage:       row.OGImage,
+		RedirectType:  row.RedirectType,
+		HasPassword:   row.HasPassword,
+		IsExpired:     gone || row.IdleExpired,
+		UsesExhausted: row.UsesExhausted,
+	}
+	if row.OGImageFile != "" {
+		p.OGImage = ogImageURL(requestScheme(r)+"://"+effectiveHost(r), code)
+	}
+	if !row.HasPassword {
+		p.LongURL = row.destination()
+	}
+	// Internal links stay off-limits to other sites' scripts.
+	if !internal {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, r, http.StatusOK, p)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportRow is one link in a GET /export download. The field names match
+// importRow, so an export can be fed back to POST /import. Password hashes
+// and uploaded images are not exported.
+type exportRow struct {
+	Code            string    `json:"code"`
+	LongURL         string    `json:"long_url"`
+	PublicEnabled   bool      `json:"public_enabled"`
+	InternalEnabled bool      `json:"internal_enabled"`
+	RedirectType    string    `json:"redirect_type"`
+	RedirectStatus  int       `json:"redirect_status"`
+	OGTitle         string    `json:"og_title"`
+	OGDescription   string    `json:"og_description"`
+	OGImage         string    `json:"og_image"`
+	Description     string    `json:"description"`
+	ExpiresAt       string    `json:"expires_at"`
+	MaxUses         int       `json:"max_uses"`
+	UseCount        int       `json:"use_count"`
+	CacheTTL        int       `json:"cache_ttl"`
+	NoAnalytics     bool      `json:"no_analytics"`
+	Tags            tagList   `json:"tags"`
+	UTMSource       string    `json:"utm_source"`
+	UTMMedium       string    `json:"utm_medium"`
+	UTMCampaign     string    `json:"utm_campaign"`
+	IOSURL          string    `json:"ios_url"`
+	AndroidURL      string    `json:"android_url"`
+	PasswordHint    string    `json:"password_hint"`
+	PathForward     bool      `json:"path_forward"`
+	ExpireAfterIdle string    `json:"expire_after_idle"`
+	ForwardQuery    bool      `json:"forward_query"`
+	ParamSpec       paramSpec `json:"param_spec"`
+	CreatedAt       string    `json:"created_at"`
+}
+
+// exportCSVHeader is the CSV header row, in csvFields order.
+var exportCSVHeader = []string{"code", "long_url", "public_enabled", "internal_enabled", "redirect_type", "redirect_status", "og_title", "og_description", "og_image", "description", "expires_at", "max_uses", "use_count", "cache_ttl", "no_analytics", "tags", "utm_source", "utm_medium", "utm_campaign", "ios_url", "android_url", "password_hint", "path_forward", "expire_after_idle", "forward_query", "param_spec", "created_at"}
+
+func newExportRow(u URLRow) exportRow {
+	return exportRow{
+		Code:            u.Code,
+		LongURL:         u.LongURL,
+		PublicEnabled:   u.PublicEnabled,
+		InternalEnabled: u.InternalEnabled,
+		RedirectType:    u.RedirectType,
+		RedirectStatus:  u.RedirectStatus,
+		OGTitle:         u.OGTitle,
+		OGDescription:   u.OGDescription,
+		OGImage:         u.OGImage,
+		Description:     u.Description,
+		ExpiresAt:       u.ExpiresAt,
+		MaxUses:         u.MaxUses,
+		UseCount:        u.UseCount,
+		CacheTTL:        u.CacheTTL,
+		NoAnalytics:     u.NoAnalytics,
+		Tags:            u.Tags,
+		UTMSource:       u.UTMSource,
+		UTMMedium:       u.UTMMedium,
+		UTMCampaign:     u.UTMCampaign,
+		IOSURL:          u.IOSURL,
+		AndroidURL:      u.AndroidURL,
+		PasswordHint:    u.PasswordHint,
+		PathForward:     u.PathForward,
+		ExpireAfterIdle: u.ExpireAfterIdle,
+		ForwardQuery:    u.ForwardQuery,
+		ParamSpec:       u.ParamSpec,
+		CreatedAt:       u.CreatedAt,
+	}
+}
+
+// csvFields renders the row for the CSV export. Tags are joined with
+// commas, as stored.
+func (e exportRow) csvFields() []string {
+	return []string{
+		e.Code, e.LongURL,
+		strconv.FormatBool(e.PublicEnabled), strconv.FormatBool(e.InternalEnabled),
+		e.RedirectType, strconv.Itoa(e.RedirectStatus),
+		e.OGTitle, e.OGDescription, e.OGImage, e.Description,
+		e.ExpiresAt, strconv.Itoa(e.MaxUses), strconv.Itoa(e.UseCount),
+		strconv.Itoa(e.CacheTTL), strconv.FormatBool(e.NoAnalytics),
+		strings.Join(e.Tags, ","), e.UTMSource, e.UTMMedium, e.UTMCampaign,
+		e.IOSURL, e.AndroidURL, e.PasswordHint, strconv.FormatBool(e.PathForward), e.ExpireAfterIdle, strconv.FormatBool(e.ForwardQuery), e.paramSpecCSV(), e.CreatedAt,
+	}
+}
+
+// paramSpecCSV is param_spec as stored: JSON, or empty when unset.
+func (e exportRow) paramSpecCSV() string {
+	v, _ := e.ParamSpec.Value()
+	return v.(string)
+}
+
+// exportHandler serves GET /export?format=csv|json (default json): every
+// link as a download named gourl-export-<timestamp>.<format>.
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "csv" && format != "json" {
+		jsonError(w, http.StatusBadRequest, "format must be csv or json")
+		return
+	}
+	urls, err := getAllURLs()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+
+	name := "gourl-export-" + time.Now().UTC().Format("20060102-150405") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		cw := csv.NewWriter(w)
+		cw.Write(exportCSVHeader)
+		for _, u := range urls {
+			cw.Write(newExportRow(u).csvFields())
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			log.Printf("export csv: %v", err)
+		}
+		return
+	}
+
+	// Encode row by row so a large table never sits in memory twice.
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("["))
+	enc := json.NewEncoder(w)
+	for i, u := range urls {
+		if i > 0 {
+			w.Write([]byte(","))
+		}
+		if err := enc.Encode(newExportRow(u)); err != nil {
+			log.Printf("export json: %v", err)
+			return
+		}
+	}
+	w.Write([]byte("]\n"))
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Outbound page fetches (destination titles, OpenGraph metadata) are bounded
+// in time, redirects and bytes read, and only ever parse HTML.
+const (
+	fetchTimeout      = 5 * time.Second
+	fetchMaxRedirects = 5
+	fetchMaxBytes     = 512 << 10
+)
+
+var fetchClient = &http.Client{
+	Timeout: fetchTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= fetchMaxRedirects {
+			return errors.New("too many redirects")
+		}
+		return nil
+	},
+}
+
+// pageMeta is what we extract from a destination's <head>.
+type pageMeta struct {
+	Title         string
+	OGTitle       string
+	OGDescription string
+	OGImage       string
+}
+
+// fetchPageMeta GETs dest and parses its title and og:* meta tags.
+func fetchPageMeta(ctx context.Context, dest string) (pageMeta, error) {
+	if u, err := url.Parse(dest); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return pageMeta{}, errors.New("not an http(s) URL")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, dest, nil)
+	if err != nil {
+		return pageMeta{}, err
+	}
+	req.Header.Set("User-Agent", "gourl-fetcher")
+	req.Header.Set("Accept", "text/html")
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return pageMeta{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return pageMeta{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "text/html" && mt != "application/xhtml+xml" {
+		return pageMeta{}, fmt.Errorf("not an HTML page (%s)", mt)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, fetchMaxBytes))
+	if err != nil {
+		return pageMeta{}, err
+	}
+	return parsePageMeta(string(body)), nil
+}
+
+var (
+	titleRe    = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	metaTagRe  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	metaAttrRe = regexp.MustCompile(`(?is)([a-z:-]+)\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+)`)
+	spaceRe    = regexp.MustCompile(`\s+`)
+)
+
+// parsePageMeta is a deliberately small scanner for <title> and
+// <meta property="og:…" content="…">; it doesn't need a full HTML parser.
+func parsePageMeta(doc string) pageMeta {
+	clean := func(s string) string {
+		return strings.TrimSpace(spaceRe.ReplaceAllString(html.UnescapeString(s), " "))
+	}
+	var m pageMeta
+	if t := titleRe.FindStringSubmatch(doc); t != nil {
+		m.Title = clean(t[1])
+	}
+	for _, tag := range metaTagRe.FindAllString(doc, -1) {
+		attrs := map[string]string{}
+		for _, a := range metaAttrRe.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(a[1])] = strings.Trim(a[2], `"'`)
+		}
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		content := clean(attrs["content"])
+		switch strings.ToLower(key) {
+		case "og:title":
+			m.OGTitle = content
+		case "og:description":
+			m.OGDescription = content
+		case "og:image":
+			m.OGImage = content
+		}
+	}
+	return m
+}
+
+// fillOGFromPage fetches rec's destination and copies its og:title,
+// og:description and og:image into whichever of rec's fields are blank.
+// A relative og:image is resolved against the destination URL.
+func fillOGFromPage(ctx context.Context, rec *urlRecord) error {
+	meta, err := fetchPageMeta(ctx, rec.LongURL)
+	if err != nil {
+		return err
+	}
+	clip := func(s string, n int) string {
+		if r := []rune(s); len(r) > n {
+			return string(r[:n])
+		}
+		return s
+	}
+	if rec.OGTitle == "" {
+		rec.OGTitle = clip(meta.OGTitle, maxOGTitleLen)
+	}
+	if rec.OGDescription == "" {
+		rec.OGDescription = clip(meta.OGDescription, maxOGDescLen)
+	}
+	if rec.OGImage == "" && meta.OGImage != "" {
+		if base, err := url.Parse(rec.LongURL); err == nil {
+			if img, err := base.Parse(meta.OGImage); err == nil && (img.Scheme == "http" || img.Scheme == "https") {
+				rec.OGImage = img.String()
+			}
+		}
+	}
+	return nil
+}
+
+// fetchTitle stores the destination's <title> for code in the background.
+// It is a no-op unless FETCH_TITLES is on, and only fills an empty title for
+// the same long_url, so a concurrent edit is never overwritten.
+func fetchTitle(code, longURL string) {
+	if !fetchTitles {
+		return
+	}
+	go func() {
+		meta, err := fetchPageMeta(context.Background(), longURL)
+		if err != nil {
+			log.Printf("fetch title %s: %v", code, err)
+			return
+		}
+		title := meta.Title
+		if title == "" {
+			title = meta.OGTitle
+		}
+		if title == "" {
+			return
+		}
+		if len([]rune(title)) > maxOGTitleLen {
+			title = string([]rune(title)[:maxOGTitleLen])
+		}
+		res, err := db.Exec("UPDATE urls SET title = ? WHERE code = ? AND long_url = ? AND title = ''", title, code, longURL)
+		if err != nil {
+			log.Printf("fetch title %s: %v", code, err)
+			return
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			markChanged()
+		}
+	}()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// maxFormBytes caps an application/x-www-form-urlencoded link body.
+const maxFormBytes = 1 << 20
+
+// decodeForm fills the JSON-tagged struct v from form fields, so an HTML
+// form or curl --data-urlencode can send what a JSON body would. Each field
+// is read by its JSON name and converted by the field's type: booleans take
+// strconv.ParseBool forms plus "on" (a checked checkbox), lists take repeated
+// fields or one comma-separated value, objects a JSON object. The result goes
+// through json.Unmarshal, so v ends up exactly as for the equivalent JSON.
+func decodeForm(form url.Values, v any) error {
+	t := reflect.TypeOf(v).Elem()
+	obj := map[string]any{}
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		vals, ok := form[name]
+		if name == "" || name == "-" || !ok || len(vals) == 0 {
+			continue
+		}
+		val, err := formValue(t.Field(i).Type, vals)
+		if err != nil {
+			return fmt.Errorf("%s must be %s", name, err)
+		}
+		obj[name] = val
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// formValue converts a field's form values for json.Marshal. Its errors
+// complete "<field> must be ...".
+func formValue(t reflect.Type, vals []string) (any, error) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	s := strings.TrimSpace(vals[0])
+	switch t.Kind() {
+	case reflect.Bool:
+		if s == "on" {
+			return true, nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, errors.New("true or false")
+		}
+		return b, nil
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, errors.New("a whole number")
+		}
+		return n, nil
+	case reflect.Slice:
+		var out []string
+		for _, v := range vals {
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					out = append(out, item)
+				}
+			}
+		}
+		return out, nil
+	case reflect.Struct:
+		if s == "" {
+			return json.RawMessage("{}"), nil
+		}
+		if !strings.HasPrefix(s, "{") || !json.Valid([]byte(s)) {
+			return nil, errors.New("a JSON object")
+		}
+		return json.RawMessage(s), nil
+	}
+	return vals[0], nil
+}
@@ -1,27 +1,120 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
 	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
 	"embed"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"html/template"
+	"io"
 	"io/fs"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	qrcode "github.com/skip2/go-qrcode"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// hashPassword is a plain sha256 hex digest, for values that are not
+// passwords (client IPs) and for verifying link and admin passwords stored
+// before bcrypt.
 func hashPassword(pw string) string {
 	h := sha256.Sum256([]byte(pw))
 	return hex.EncodeToString(h[:])
 }
 
+// Values of urls.password_algo.
+const (
+	passwordAlgoSHA256 = "sha256"
+	passwordAlgoBcrypt = "bcrypt"
+)
+
+// hashLinkPassword hashes a new link password with bcrypt at
+// PASSWORD_BCRYPT_COST.
+func hashLinkPassword(pw string) (string, error) {
+	cost := min(max(passwordBcryptCost, bcrypt.MinCost), bcrypt.MaxCost)
+	h, err := bcrypt.GenerateFromPassword([]byte(pw), cost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", errors.New("password must be at most 72 bytes")
+	}
+	return string(h), err
+}
+
+// linkPasswordOK checks pw against a stored hash made with algo.
+func linkPasswordOK(hash, algo, pw string) bool {
+	if algo == passwordAlgoSHA256 {
+		return subtle.ConstantTimeCompare([]byte(hashPassword(pw)), []byte(hash)) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw)) == nil
+}
+
+// upgradePasswordHash rehashes a sha256 link password with bcrypt after it
+// was verified. The old hash is part of the match so a concurrent password
+// change wins.
+func upgradePasswordHash(code, oldHash, pw string) {
+	h, err := hashLinkPassword(pw)
+	if err == nil {
+		_, err = db.Exec("UPDATE urls SET password_hash = ?, password_algo = ? WHERE code = ? AND password_hash = ?", h, passwordAlgoBcrypt, code, oldHash)
+	}
+	if err != nil {
+		log.Printf("upgrade password hash %s: %v", code, err)
+	}
+}
+
+// checkPasswordStrength enforces PASSWORD_MIN_LENGTH and PASSWORD_MIN_CLASSES
+// on a new, non-empty link password.
+func checkPasswordStrength(pw string) error {
+	if n := utf8.RuneCountInString(pw); n < passwordMinLength {
+		return fmt.Errorf("password must be at least %d characters", passwordMinLength)
+	}
+	var lower, upper, digit, other int
+	for _, c := range pw {
+		switch {
+		case unicode.IsLower(c):
+			lower = 1
+		case unicode.IsUpper(c):
+			upper = 1
+		case unicode.IsDigit(c):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	if lower+upper+digit+other < passwordMinClasses {
+		return fmt.Errorf("password must mix at least %d of: lowercase, uppercase, digits, symbols", passwordMinClasses)
+	}
+	return nil
+}
+
+// checkPasswordHint trims a password_hint and checks it is a single line of
+// at most maxPasswordHintLen characters. The js template escapes it.
+func checkPasswordHint(hint *string) error {
+	if hint == nil {
+		return nil
+	}
+	*hint = strings.TrimSpace(*hint)
+	if utf8.RuneCountInString(*hint) > maxPasswordHintLen {
+		return fmt.Errorf("password_hint is longer than %d characters", maxPasswordHintLen)
+	}
+	if strings.IndexFunc(*hint, unicode.IsControl) >= 0 {
+		return errors.New("password_hint must be a single line of text")
+	}
+	return nil
+}
+
 //go:embed static
 var staticFiles embed.FS
 
@@ -42,13 +135,6 @@ var indexTmpl = template.Must(
 			}
 			return s
 		},
-		"formatExpiry": func(s string) string {
-			t, err := time.Parse(time.RFC3339, s)
-			if err != nil {
-				return s
-			}
-			return t.UTC().Format("2006-01-02 15:04 UTC")
-		},
 	}).Parse(indexTmplSrc),
 )
 
@@ -75,8 +161,8 @@ func hostOf(u string) string {
 	return strings.TrimRight(u, "/")
 }
 
-// isAllowedOrigin reports whether the CORS origin matches the public base or alias base.
-func isAllowedOrigin(origin, pb, ab string) bool {
+// isAllowedOrigin reports whether the CORS origin matches the public base or an alias base.
+func isAllowedOrigin(origin, pb string, aliasBases []string) bool {
 	if origin == "" {
 		return false
 	}
@@ -84,7 +170,7 @@ func isAllowedOrigin(origin, pb, ab string) bool {
 	if h := hostOf(pb); h != "" && originHost == h {
 		return true
 	}
-	if ab != "" {
+	for _, ab := range aliasBases {
 		if h := hostOf(ab); h != "" && originHost == h {
 			return true
 		}
@@ -92,6 +178,18 @@ func isAllowedOrigin(origin, pb, ab string) bool {
 	return false
 }
 
+// apiOriginAllowed reports whether a browser on origin may call the link
+// endpoints of the public API host: the public or alias base, or a host in
+// the cors_origins setting.
+func apiOriginAllowed(origin string) bool {
+	pb, _, _, _, _ := cfg.snapshot()
+	if isAllowedOrigin(origin, pb, cfg.aliasBases()) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Hostname() != "" && hostListMatches(cfg.setting("cors_origins"), strings.ToLower(u.Hostname()))
+}
+
 // requestScheme returns the scheme of the incoming request, honouring X-Forwarded-Proto.
 func requestScheme(r *http.Request) string {
 	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
@@ -124,13 +222,16 @@ var metaRedirectTmpl = template.Must(template.New("meta").Parse(`<!DOCTYPE html>
 <body><p>Redirecting… <a href="{{.LongURL}}">click here</a></p></body>
 </html>`))
 
+// redirectTmplFuncs are shared by the redirect page templates.
+var redirectTmplFuncs = template.FuncMap{
+	"jsStr": func(s string) template.JS {
+		b, _ := json.Marshal(s)
+		return template.JS(b)
+	},
+}
+
 var jsRedirectTmpl = template.Must(
-	template.New("js").Funcs(template.FuncMap{
-		"jsStr": func(s string) template.JS {
-			b, _ := json.Marshal(s)
-			return template.JS(b)
-		},
-	}).Parse(`<!DOCTYPE html>
+	template.New("js").Funcs(redirectTmplFuncs).Parse(`<!DOCTYPE html>
 <html lang="en">
 <head><meta charset="UTF-8">
 <meta name="robots" content="noindex,nofollow">
@@ -147,7 +248,7 @@ var jsRedirectTmpl = template.Must(
 <style>:root{color-scheme:light dark}body{margin:0;min-height:100vh;display:flex;align-items:center;justify-content:center;background-color:Canvas;color:CanvasText;font-family:system-ui,sans-serif;font-size:.9rem}a{color:LinkText}form{display:flex;flex-direction:column;align-items:center;gap:.6rem}input[type=password]{padding:.5rem .75rem;border:1.5px solid #cbd5e0;border-radius:6px;font-size:.9rem;outline:none;width:220px;background:Canvas;color:CanvasText}button{padding:.5rem 1.25rem;background:#667eea;color:#fff;border:none;border-radius:6px;font-size:.9rem;cursor:pointer}#pw-err{color:#c53030;font-size:.8rem}</style>
 </head>
 <body>{{if .HasPassword}}<div style="text-align:center">
-<p style="margin-bottom:.9rem">🔒 This link is password protected.</p>
+<p style="margin-bottom:.9rem">🔒 {{or .PasswordHint "This link is password protected."}}</p>
 <form id="pw-form">
 <input type="password" id="pw-input" placeholder="Enter password" autofocus>
 <button type="submit">Continue →</button>
@@ -159,7 +260,7 @@ document.getElementById('pw-form').onsubmit=async function(e){
 e.preventDefault();
 var r=await fetch({{jsStr .PassURL}},{method:'POST',headers:{'Content-Type':'application/json'},body:JSON.stringify({password:document.getElementById('pw-input').value})});
 if(r.ok){var d=await r.json();window.location.replace(d.url);}
-else{document.getElementById('pw-err').style.display='';document.getElementById('pw-input').value='';document.getElementById('pw-input').focus();}
+else{var el=document.getElementById('pw-err');el.textContent=r.status===429?'Too many attempts. Try again later.':'Incorrect password.';el.style.display='';document.getElementById('pw-input').value='';document.getElementById('pw-input').focus();}
 };
 </script>{{else}}
 <p>Redirecting… <a href="{{.LongURL}}">click here</a></p>
@@ -168,21 +269,60 @@ else{document.getElementById('pw-err').style.display='';document.getElementById(
 </body>
 </html>`))
 
+// indexPageSize is how many links renderIndex puts in the page; the UI's
+// "Load more" fetches the rest from GET /urls in pages of the same size.
+const indexPageSize = 50
+
+// renderIndex renders the first page of the link table, newest first unless
+// ?sort= and ?order= (as for GET /urls) say otherwise.
 func renderIndex(w http.ResponseWriter, r *http.Request) {
-	urls, _ := getAllURLs()
+	lq, err := parseListQuery(url.Values{"sort": {r.URL.Query().Get("sort")}, "order": {r.URL.Query().Get("order")}})
+	if err != nil {
+		lq = urlListQuery{Sort: "created_at", Desc: true}
+	}
+	lq.Limit = indexPageSize
+	urls, total, _ := listURLs(lq)
+	loc, err := requestLocation(r)
+	if err != nil {
+		loc = displayLocation()
+	}
+	for i := range urls {
+		urls[i].localize(loc)
+	}
 	pb, _, uh, ih, ah := cfg.snapshot()
 	papiHost := cfg.publicAPIHostVal()
 
 	data := struct {
-		URLs          []URLRow
-		Base          string
-		AliasBase     string
-		UIHost        string
-		InternalHost  string
-		AliasHost     string
-		PublicAPIHost string
-		BuildVersion  string
-	}{URLs: urls, Base: pb, AliasBase: cfg.aliasBase(), UIHost: uh, InternalHost: ih, AliasHost: ah, PublicAPIHost: papiHost, BuildVersion: buildVersion}
+		URLs                []URLRow
+		Total               int
+		PageSize            int
+		Base                string
+		AliasBase           string
+		UIHost              string
+		InternalHost        string
+		AliasHost           string
+		PublicAPIHost       string
+		Maintenance         bool
+		CanonicalLink       bool
+		Noindex             bool
+		PreferDestQuery     bool
+		DefaultRedirectType string
+		ExpiryGrace         string
+		InternalRoot        string
+		NotFoundURL         string
+		InternalNotFoundURL string
+		AdminAuth           bool
+		BuildVersion        string
+		Sort                string
+		SortDesc            bool
+		BlockedHosts        string
+		AllowedHosts        string
+		SiteTitle           string
+		FaviconURL          string
+		Timezone            string
+		TimezoneSetting     string
+		WebhookURL          string
+	}{Total: total, PageSize: indexPageSize, Timezone: loc.String(), TimezoneSetting: cfg.setting("timezone"), WebhookURL: cfg.setting("webhook_url"), SiteTitle: cmp.Or(cfg.setting("site_title"), defaultSiteTitle), FaviconURL: cfg.setting("favicon_url"), Sort: lq.Sort, SortDesc: lq.Desc, BlockedHosts: strings.ReplaceAll(cfg.setting("blocked_hosts"), ",", ", "), AllowedHosts: strings.ReplaceAll(cfg.setting("allowed_hosts"), ",", ", "), URLs: urls, Base: pb, AliasBase: cfg.aliasBase(nil), UIHost: uh, InternalHost: ih, AliasHost: ah, PublicAPIHost: papiHost, Maintenance: cfg.enabled("maintenance"), CanonicalLink: cfg.enabled("canonical_link"), Noindex: cfg.enabled("noindex"), PreferDestQuery: cfg.enabled("forward_query_prefer_destination"), DefaultRedirectType: sanitizeRedirectType(""), ExpiryGrace: cfg.setting("expiry_grace"), InternalRoot: cfg.setting("internal_root_redirect"), NotFoundURL: cfg.setting("not_found_redirect"), InternalNotFoundURL: cfg.setting("internal_not_found_redirect"), AdminAuth: adminAuthEnabled(), BuildVersion: buildVersion}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := indexTmpl.Execute(w, data); err != nil {
@@ -190,62 +330,186 @@ func renderIndex(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func jsonError(w http.ResponseWriter, status int, msg string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+// redirectTypeInfo documents one redirect_type value as implemented by doRedirect.
+type redirectTypeInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Password    bool   `json:"supports_password"`
+	OG          bool   `json:"supports_og"`
 }
 
-func shortenHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// redirectTypes lists every redirect_type doRedirect understands; the first
+// entry is the default. Keep it in sync when adding a type.
+var redirectTypes = []redirectTypeInfo{
+	{Name: "redirect", Description: "HTTP 302 redirect straight to the destination"},
+	{Name: "meta", Description: "HTML page with OpenGraph tags and a meta refresh, so link previews show custom metadata", OG: true},
+	{Name: "js", Description: "HTML page with OpenGraph tags that redirects via JavaScript; can require a password first", Password: true, OG: true},
+	{Name: "applink", Description: "HTML page with OpenGraph tags that opens ios_url or android_url on phones and falls back to the destination", OG: true},
+}
+
+// defaultRedirectStatus is the redirect_status of links that set none.
+const defaultRedirectStatus = http.StatusFound
+
+// validRedirectStatus reports whether s is allowed as a link's
+// redirect_status: permanent (301, 308) or temporary (302, 307), where 307
+// and 308 keep the request method and body.
+func validRedirectStatus(s int) bool {
+	switch s {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// defaultRedirectTypes are the redirect types the default_redirect_type
+// setting may name; applink needs per-link app URLs.
+var defaultRedirectTypes = []string{"redirect", "meta", "js"}
+
+// sanitizeRedirectType returns rt if it is a known redirect type, else the
+// default_redirect_type setting.
+func sanitizeRedirectType(rt string) string {
+	for _, t := range redirectTypes {
+		if t.Name == rt {
+			return rt
+		}
+	}
+	return cmp.Or(cfg.setting("default_redirect_type"), redirectTypes[0].Name)
+}
+
+// redirectTypesHandler serves GET /redirect-types.
+func redirectTypesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	writeJSON(w, r, http.StatusOK, redirectTypes)
+}
 
-	var body struct {
-		URL             string `json:"url"`
-		CustomCode      string `json:"custom_code"`
-		PublicEnabled   *bool  `json:"public_enabled"`
-		InternalEnabled *bool  `json:"internal_enabled"`
-		RedirectType    string `json:"redirect_type"`
-		OGTitle         string `json:"og_title"`
-		OGDescription   string `json:"og_description"`
-		OGImage         string `json:"og_image"`
-		Password        string `json:"password"`
-		Description     string `json:"description"`
-		ExpiresAt       string `json:"expires_at"`
-		MaxUses         int    `json:"max_uses"`
+// writeJSON writes v as the JSON response body. Clients that prefer
+// camelCase keys can pass ?case=camel; snake_case stays the default so
+// existing clients are unaffected.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	if r.URL.Query().Get("case") == "camel" {
+		if b, err := json.Marshal(v); err == nil {
+			var tree any
+			dec := json.NewDecoder(bytes.NewReader(b))
+			dec.UseNumber()
+			if dec.Decode(&tree) == nil {
+				v = camelKeys(tree)
+			}
+		}
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.URL) == "" {
-		jsonError(w, http.StatusBadRequest, "invalid JSON or missing url field")
-		return
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// camelKeys rewrites every object key in a decoded JSON tree from
+// snake_case to camelCase ("long_url" → "longUrl").
+func camelKeys(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, val := range t {
+			parts := strings.Split(k, "_")
+			for i := 1; i < len(parts); i++ {
+				if parts[i] != "" {
+					parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+				}
+			}
+			out[strings.Join(parts, "")] = camelKeys(val)
+		}
+		return out
+	case []any:
+		for i := range t {
+			t[i] = camelKeys(t[i])
+		}
+		return t
+	}
+	return v
+}
+
+func jsonError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// shortenRequest is the body of POST /shorten and one item of POST
+// /shorten/bulk.
+type shortenRequest struct {
+	URL             string    `json:"url"`
+	CustomCode      string    `json:"custom_code"`
+	PublicEnabled   *bool     `json:"public_enabled"`
+	InternalEnabled *bool     `json:"internal_enabled"`
+	RedirectType    string    `json:"redirect_type"`
+	RedirectStatus  int       `json:"redirect_status"` // 0 = 302
+	OGTitle         string    `json:"og_title"`
+	OGDescription   string    `json:"og_description"`
+	OGImage         string    `json:"og_image"`
+	Password        string    `json:"password"`
+	Description     string    `json:"description"`
+	ExpiresAt       string    `json:"expires_at"`
+	MaxUses         int       `json:"max_uses"`
+	CacheTTL        *int      `json:"cache_ttl"`
+	NoAnalytics     bool      `json:"no_analytics"`
+	Tags            []string  `json:"tags"`
+	UTMSource       string    `json:"utm_source"`
+	UTMMedium       string    `json:"utm_medium"`
+	UTMCampaign     string    `json:"utm_campaign"`
+	IOSURL          string    `json:"ios_url"`
+	AndroidURL      string    `json:"android_url"`
+	PasswordHint    string    `json:"password_hint"`
+	PathForward     bool      `json:"path_forward"`
+	ExpireAfterIdle string    `json:"expire_after_idle"`
+	ForwardQuery    bool      `json:"forward_query"`
+	ParamSpec       paramSpec `json:"param_spec"`
+	FetchOG         bool      `json:"fetch_og"`       // fill blank og_* fields from the destination; ignored by /shorten/bulk
+	ReuseExisting   bool      `json:"reuse_existing"` // same as ?reuse=true; ignored by /shorten/bulk
+}
+
+// record validates the request and builds the link to store. code is the
+// custom code, or "" when one should be generated.
+func (body shortenRequest) record() (rec urlRecord, code string, err error) {
+	if strings.TrimSpace(body.URL) == "" {
+		return rec, "", errors.New("invalid JSON or missing url field")
 	}
 
 	longURL := strings.TrimSpace(body.URL)
+	if err := checkDestinationHost(longURL); err != nil {
+		return rec, "", err
+	}
+	if err := checkTemplateURL(longURL); err != nil {
+		return rec, "", err
+	}
 	customCode := strings.TrimSpace(body.CustomCode)
 	publicEnabled := body.PublicEnabled == nil || *body.PublicEnabled
 	internalEnabled := body.InternalEnabled == nil || *body.InternalEnabled
 
 	if !publicEnabled && !internalEnabled {
-		jsonError(w, http.StatusBadRequest, "at least one link type (public_enabled or internal_enabled) must be true")
-		return
+		return rec, "", errors.New("at least one link type (public_enabled or internal_enabled) must be true")
 	}
 
-	redirectType := body.RedirectType
-	if redirectType != "meta" && redirectType != "js" {
-		redirectType = "redirect"
+	redirectType := sanitizeRedirectType(body.RedirectType)
+	redirectStatus := cmp.Or(body.RedirectStatus, defaultRedirectStatus)
+	if !validRedirectStatus(redirectStatus) {
+		return rec, "", errors.New("redirect_status must be 301, 302, 307 or 308")
 	}
 	ogTitle, ogDescription, ogImage := body.OGTitle, body.OGDescription, body.OGImage
 	description := body.Description
 	passwordHash := ""
 	if body.Password != "" {
-		passwordHash = hashPassword(body.Password)
+		if err := checkPasswordStrength(body.Password); err != nil {
+			return rec, "", err
+		}
+		if passwordHash, err = hashLinkPassword(body.Password); err != nil {
+			return rec, "", err
+		}
 	}
 	expiresAt := ""
 	if body.ExpiresAt != "" {
 		if _, err := time.Parse(time.RFC3339, body.ExpiresAt); err != nil {
-			jsonError(w, http.StatusBadRequest, "expires_at must be RFC3339 (e.g. 2026-03-01T00:00:00Z)")
-			return
+			return rec, "", errors.New("expires_at must be RFC3339 (e.g. 2026-03-01T00:00:00Z)")
 		}
 		expiresAt = body.ExpiresAt
 	}
@@ -253,73 +517,329 @@ func shortenHandler(w http.ResponseWriter, r *http.Request) {
 	if maxUses < 0 {
 		maxUses = 0
 	}
-
-	var code string
+	cacheTTL := -1
+	if body.CacheTTL != nil {
+		if *body.CacheTTL < -1 {
+			return rec, "", errors.New("cache_ttl must be seconds (0 = no-store, -1 = default)")
+		}
+		cacheTTL = *body.CacheTTL
+	}
+	tags, err := linkTags(body.Tags)
+	if err != nil {
+		return rec, "", err
+	}
+	if err := checkUTM(&body.UTMSource, &body.UTMMedium, &body.UTMCampaign); err != nil {
+		return rec, "", err
+	}
+	if err := checkAppURL("ios_url", &body.IOSURL); err != nil {
+		return rec, "", err
+	}
+	if err := checkAppURL("android_url", &body.AndroidURL); err != nil {
+		return rec, "", err
+	}
+	if err := checkAppLink(redirectType, body.IOSURL, body.AndroidURL); err != nil {
+		return rec, "", err
+	}
+	if err := checkPasswordHint(&body.PasswordHint); err != nil {
+		return rec, "", err
+	}
+	if err := checkExpireAfterIdle(&body.ExpireAfterIdle); err != nil {
+		return rec, "", err
+	}
+	if err := checkParamSpec(longURL, &body.ParamSpec); err != nil {
+		return rec, "", err
+	}
 	if customCode != "" {
 		if !validCode.MatchString(customCode) {
-			jsonError(w, http.StatusBadRequest, "custom alias must be 1–32 chars: letters, numbers, hyphens, underscores")
+			return rec, "", errors.New("custom alias must be 1–32 chars: letters, numbers, hyphens, underscores")
+		}
+		if blockedCode(customCode) {
+			return rec, "", fmt.Errorf("alias '%s' is not allowed", customCode)
+		}
+	}
+	rec = urlRecord{
+		LongURL:         longURL,
+		PublicEnabled:   publicEnabled,
+		InternalEnabled: internalEnabled,
+		RedirectType:    redirectType,
+		RedirectStatus:  redirectStatus,
+		OGTitle:         ogTitle,
+		OGDescription:   ogDescription,
+		OGImage:         ogImage,
+		PasswordHash:    passwordHash,
+		Description:     description,
+		ExpiresAt:       expiresAt,
+		MaxUses:         maxUses,
+		CacheTTL:        cacheTTL,
+		NoAnalytics:     body.NoAnalytics,
+		Tags:            tags,
+		UTMSource:       body.UTMSource,
+		UTMMedium:       body.UTMMedium,
+		UTMCampaign:     body.UTMCampaign,
+		IOSURL:          body.IOSURL,
+		AndroidURL:      body.AndroidURL,
+		PasswordHint:    body.PasswordHint,
+		PathForward:     body.PathForward,
+		ExpireAfterIdle: body.ExpireAfterIdle,
+		ForwardQuery:    body.ForwardQuery,
+		ParamSpec:       body.ParamSpec,
+	}
+	return rec, customCode, nil
+}
+
+func shortenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	result := "error"
+	defer func() { shortenTotal.WithLabelValues(result).Inc() }()
+
+	var body shortenRequest
+	upload, err := decodeLinkBody(w, r, &body)
+	if err != nil {
+		result = "rejected"
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rec, code, err := body.record()
+	if err != nil {
+		result = "rejected"
+		status := http.StatusBadRequest
+		if errors.Is(err, errHostNotAllowed) {
+			status = http.StatusForbidden
+		}
+		jsonError(w, status, err.Error())
+		return
+	}
+	// Reuse: hand back an existing live link to the same destination instead
+	// of minting another code. A custom code always gets its own link.
+	if code == "" && (body.ReuseExisting || r.URL.Query().Get("reuse") == "true") {
+		row, found, err := findReusableURL(rec)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if found {
+			result = "reused"
+			writeJSON(w, r, http.StatusOK, linkJSON(row))
 			return
 		}
-		if err := saveURL(customCode, longURL, publicEnabled, internalEnabled, redirectType, ogTitle, ogDescription, ogImage, passwordHash, description, expiresAt, maxUses); err != nil {
-			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-				jsonError(w, http.StatusConflict, fmt.Sprintf("alias '%s' is already taken", customCode))
+	}
+	if body.FetchOG {
+		// Best effort: the link is still created when the page can't be read.
+		if err := fillOGFromPage(r.Context(), &rec); err != nil {
+			log.Printf("fetch og %s: %v", rec.LongURL, err)
+		}
+	}
+
+	if code != "" {
+		if err := saveURL(code, rec); err != nil {
+			if isUniqueViolation(err) {
+				result = "conflict"
+				jsonError(w, http.StatusConflict, fmt.Sprintf("alias '%s' is already taken", code))
 			} else {
 				jsonError(w, http.StatusInternalServerError, "database error")
 			}
 			return
 		}
-		code = customCode
 	} else {
-		for {
-			var err error
-			code, err = generateCode()
-			if err != nil {
-				jsonError(w, http.StatusInternalServerError, "internal error")
-				return
-			}
-			err = saveURL(code, longURL, publicEnabled, internalEnabled, redirectType, ogTitle, ogDescription, ogImage, passwordHash, description, expiresAt, maxUses)
-			if err == nil {
-				break
-			}
-			if !strings.Contains(err.Error(), "UNIQUE constraint failed") {
-				jsonError(w, http.StatusInternalServerError, "database error")
-				return
-			}
+		if code, err = saveURLGenerated(rec); err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+	}
+	if upload != nil {
+		if err := setOGImage(code, upload); err != nil {
+			log.Printf("store og image %s: %v", code, err)
+			jsonError(w, http.StatusInternalServerError, "could not store og_image_file")
+			return
 		}
 	}
+	logAuditBestEffort(code, auditCreate, "", rec.LongURL, clientIP(r))
+	fetchTitle(code, rec.LongURL)
 
-	pb, _, _, ih, _ := cfg.snapshot()
-	ab := cfg.aliasBase()
-	resp := map[string]any{
-		"code":             code,
-		"long_url":         longURL,
-		"public_enabled":   publicEnabled,
-		"internal_enabled": internalEnabled,
-		"redirect_type":    redirectType,
-		"og_title":         ogTitle,
-		"og_description":   ogDescription,
-		"og_image":         ogImage,
-		"has_password":     passwordHash != "",
-		"description":      description,
-		"expires_at":       expiresAt,
-		"max_uses":         maxUses,
-		"use_count":        0,
-	}
-	if publicEnabled {
-		resp["short_url"] = fmt.Sprintf("%s/%s", pb, code)
+	row, err := getURLRow(code)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	result = "created"
+	writeJSON(w, r, http.StatusCreated, linkJSON(row))
+}
+
+// linkView is the JSON shape of a link shared by every endpoint that returns
+// one (shorten, list, single-record, preview …), so clients see the same
+// fields everywhere. The password hash is never serialized — only has_password.
+// The *_url fields are present only for the enabled link types. qr_url is
+// the QR code of the public (or alias) short URL, served by the public API
+// host or else the UI host; for internal-only links it is the internal QR.
+type linkView struct {
+	URLRow
+	ShortURL    string `json:"short_url,omitempty"`
+	AliasURL    string `json:"alias_url,omitempty"`
+	InternalURL string `json:"internal_url,omitempty"`
+	QRURL       string `json:"qr_url,omitempty"`
+}
+
+func linkJSON(row URLRow) linkView {
+	v := linkView{URLRow: row}
+	pb, _, uh, ih, _ := cfg.snapshot()
+	ab := cfg.aliasBase(nil)
+	if row.PublicEnabled {
+		v.ShortURL = fmt.Sprintf("%s/%s", pb, row.Code)
 		if ab != "" {
-			resp["alias_url"] = fmt.Sprintf("%s/%s", ab, code)
+			v.AliasURL = fmt.Sprintf("%s/%s", ab, row.Code)
+		}
+		if base := cmp.Or(cfg.publicAPIBase(), strings.TrimRight(uh, "/")); base != "" {
+			v.QRURL = fmt.Sprintf("%s/qr/%s", base, row.Code)
 		}
 	}
-	if internalEnabled {
+	if row.InternalEnabled {
 		// ih is stored as a full URL (e.g. "http://go"); strip the scheme so
 		// the internal link reads as "go/code" for display and clipboard.
-		resp["internal_url"] = fmt.Sprintf("%s/%s", hostOf(ih), code)
+		v.InternalURL = fmt.Sprintf("%s/%s", hostOf(ih), row.Code)
+		if v.QRURL == "" {
+			v.QRURL = fmt.Sprintf("%s/qr/%s?host=internal", strings.TrimRight(ih, "/"), row.Code)
+		}
 	}
+	return v
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(resp)
+// urlsListHandler serves GET /urls: every link as JSON, newest first. ?q=
+// keeps links whose code, long_url or description contains the term and ?tag=
+// those carrying the tag, ?expiring_within=24h those expiring that soon;
+// ?sort=created_at|code|use_count|last_accessed_at, ?order=asc|desc,
+// ?limit= (max maxListLimit) and ?offset= page through them. X-Total-Count
+// has the number of matching links.
+func urlsListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lq, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	loc, err := requestLocation(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Read the version before querying: a write racing the query then yields
+	// an older ETag, so the next poll refetches instead of missing the change.
+	// The minute is part of the tag because is_expired, idle_expired and
+	// ?expiring_within= change with the clock, not with writes.
+	q := fnv.New32a()
+	q.Write([]byte(r.URL.RawQuery))
+	etag := fmt.Sprintf(`"%x-%d-%d-%x"`, bootID, dataVersion.Load(), time.Now().Unix()/60, q.Sum32())
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	urls, total, err := listURLs(lq)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	links := make([]linkView, len(urls))
+	for i, u := range urls {
+		u.localize(loc)
+		links[i] = linkJSON(u)
+	}
+	writeJSON(w, r, http.StatusOK, links)
+}
+
+const maxListLimit = 1000
+
+func parseListQuery(v url.Values) (urlListQuery, error) {
+	q := urlListQuery{Search: strings.TrimSpace(v.Get("q")), Sort: "created_at", Desc: true}
+	if t := v.Get("tag"); t != "" {
+		q.Tag = strings.ToLower(strings.TrimSpace(t))
+		if !validTag.MatchString(q.Tag) {
+			return q, errors.New("tag must be 1–24 letters, numbers or hyphens")
+		}
+	}
+	if s := v.Get("expiring_within"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return q, errors.New("expiring_within must be a positive duration like 24h")
+		}
+		q.ExpiringWithin = d
+	}
+	if s := v.Get("sort"); s != "" {
+		if _, ok := urlSortColumns[s]; !ok {
+			return q, errors.New("sort must be created_at, code, use_count or last_accessed_at")
+		}
+		q.Sort = s
+		q.Desc = s == "created_at" || s == "last_accessed_at" // dates default to newest first, the rest A→Z / low→high
+	}
+	switch v.Get("order") {
+	case "":
+	case "asc":
+		q.Desc = false
+	case "desc":
+		q.Desc = true
+	default:
+		return q, errors.New("order must be asc or desc")
+	}
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"limit", &q.Limit}, {"offset", &q.Offset}} {
+		if s := v.Get(p.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("%s must be a non-negative integer", p.name)
+			}
+			*p.dst = n
+		}
+	}
+	if q.Limit > maxListLimit {
+		q.Limit = maxListLimit
+	}
+	return q, nil
+}
+
+// urlsExpiringHandler serves GET /urls/expiring?within=48h (default 24h):
+// live links whose expires_at falls inside the window, soonest first.
+func urlsExpiringHandler(w http.ResponseWriter, r *http.Request) {
+	within := 24 * time.Hour
+	if v := r.URL.Query().Get("within"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			jsonError(w, http.StatusBadRequest, "within must be a positive duration such as 48h")
+			return
+		}
+		within = d
+	}
+	urls, err := getExpiringURLs(within)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	links := make([]linkView, len(urls))
+	for i, u := range urls {
+		links[i] = linkJSON(u)
+	}
+	writeJSON(w, r, http.StatusOK, links)
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag,
+// using the weak comparison RFC 9110 prescribes for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
 }
 
 func urlsHandler(w http.ResponseWriter, r *http.Request) {
@@ -328,14 +848,73 @@ func urlsHandler(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	if code, ok := strings.CutSuffix(code, "/regenerate"); ok {
+		urlsRegenerateHandler(w, r, code)
+		return
+	}
+	if code, ok := strings.CutSuffix(code, "/history"); ok {
+		urlsHistoryHandler(w, r, code)
+		return
+	}
+	if code, ok := strings.CutSuffix(code, "/restore"); ok {
+		urlsRestoreHandler(w, r, code)
+		return
+	}
 
 	switch r.Method {
+	case http.MethodGet:
+		loc, err := requestLocation(r)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		row, err := getURLRow(code)
+		if err == sql.ErrNoRows {
+			jsonError(w, http.StatusNotFound, "not found")
+			return
+		} else if err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		row.localize(loc)
+		writeJSON(w, r, http.StatusOK, linkJSON(row))
 	case http.MethodDelete:
+		if deleteConfirmClicks > 0 {
+			clicks, err := redirectCount(code)
+			if err != nil {
+				jsonError(w, http.StatusInternalServerError, "database error")
+				return
+			}
+			// Popular links need the current click count echoed back, so a
+			// stray click in a client can't remove them.
+			if clicks > deleteConfirmClicks && r.URL.Query().Get("confirm") != strconv.Itoa(clicks) {
+				writeJSON(w, r, http.StatusConflict, map[string]any{
+					"error":   fmt.Sprintf("link has %d recorded clicks; repeat with ?confirm=%d", clicks, clicks),
+					"confirm": clicks,
+				})
+				return
+			}
+		}
+		// ?purge=true skips the trash, and also empties it of this code.
+		if r.URL.Query().Get("purge") == "true" {
+			if image, err := purgeURL(code); err == sql.ErrNoRows {
+				jsonError(w, http.StatusNotFound, "not found")
+			} else if err != nil {
+				jsonError(w, http.StatusInternalServerError, "database error")
+			} else {
+				logAuditBestEffort(code, auditPurge, "", "", clientIP(r))
+				removeOGImageFile(image)
+				w.WriteHeader(http.StatusNoContent)
+			}
+			return
+		}
+		rec, _ := getRecord(code)
 		if err := deleteURL(code); err == sql.ErrNoRows {
 			jsonError(w, http.StatusNotFound, "not found")
 		} else if err != nil {
 			jsonError(w, http.StatusInternalServerError, "database error")
 		} else {
+			logAuditBestEffort(code, auditDelete, rec.LongURL, "", clientIP(r))
 			w.WriteHeader(http.StatusNoContent)
 		}
 	case http.MethodPatch:
@@ -345,53 +924,119 @@ func urlsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func urlsPatchHandler(w http.ResponseWriter, r *http.Request, code string) {
-	var body struct {
-		NewCode         *string `json:"code"`
-		LongURL         *string `json:"long_url"`
-		PublicEnabled   *bool   `json:"public_enabled"`
-		InternalEnabled *bool   `json:"internal_enabled"`
-		RedirectType    *string `json:"redirect_type"`
-		OGTitle         *string `json:"og_title"`
-		OGDescription   *string `json:"og_description"`
-		OGImage         *string `json:"og_image"`
-		Password        *string `json:"password"`
-		Description     *string `json:"description"`
-		ExpiresAt       *string `json:"expires_at"`
-		MaxUses         *int    `json:"max_uses"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		jsonError(w, http.StatusBadRequest, "invalid JSON")
+// urlsRegenerateHandler serves POST /urls/{code}/regenerate: the link moves
+// to a new random code, keeping every setting, its created_at and its
+// clicks, e.g. after the old code leaked. The old code stops working.
+func urlsRegenerateHandler(w http.ResponseWriter, r *http.Request, code string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-
-	rec, err := getRecord(code)
-	if err == sql.ErrNoRows {
+	if _, err := getRecord(code); err == sql.ErrNoRows {
 		jsonError(w, http.StatusNotFound, "not found")
 		return
 	} else if err != nil {
 		jsonError(w, http.StatusInternalServerError, "database error")
 		return
 	}
-
-	nextPub := rec.PublicEnabled
-	if body.PublicEnabled != nil {
-		nextPub = *body.PublicEnabled
+	tx, err := db.Begin()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
 	}
-	nextInt := rec.InternalEnabled
-	if body.InternalEnabled != nil {
-		nextInt = *body.InternalEnabled
+	defer tx.Rollback()
+	newCode, err := renameURLGenerated(tx, code)
+	if err == nil {
+		err = logAudit(tx, newCode, auditRename, code, newCode, clientIP(r))
 	}
-
-	if body.LongURL != nil && strings.TrimSpace(*body.LongURL) == "" {
-		jsonError(w, http.StatusBadRequest, "long_url cannot be empty")
+	if err != nil {
+		log.Printf("regenerate %s: %v", code, err)
+		jsonError(w, http.StatusInternalServerError, "database error")
 		return
 	}
-
-	// Sanitize redirect_type
-	if body.RedirectType != nil && *body.RedirectType != "meta" && *body.RedirectType != "js" {
-		rt := "redirect"
-		body.RedirectType = &rt
+	if err := tx.Commit(); err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	markChanged()
+	forgetRecord(code, newCode)
+	row, err := getURLRow(newCode)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, linkJSON(row))
+}
+
+func urlsPatchHandler(w http.ResponseWriter, r *http.Request, code string) {
+	var body struct {
+		NewCode         *string    `json:"code"`
+		LongURL         *string    `json:"long_url"`
+		PublicEnabled   *bool      `json:"public_enabled"`
+		InternalEnabled *bool      `json:"internal_enabled"`
+		RedirectType    *string    `json:"redirect_type"`
+		RedirectStatus  *int       `json:"redirect_status"`
+		OGTitle         *string    `json:"og_title"`
+		OGDescription   *string    `json:"og_description"`
+		OGImage         *string    `json:"og_image"`
+		Password        *string    `json:"password"`
+		Description     *string    `json:"description"`
+		ExpiresAt       *string    `json:"expires_at"`
+		MaxUses         *int       `json:"max_uses"`
+		CacheTTL        *int       `json:"cache_ttl"`
+		NoAnalytics     *bool      `json:"no_analytics"`
+		Tags            *[]string  `json:"tags"`
+		UTMSource       *string    `json:"utm_source"`
+		UTMMedium       *string    `json:"utm_medium"`
+		UTMCampaign     *string    `json:"utm_campaign"`
+		IOSURL          *string    `json:"ios_url"`
+		AndroidURL      *string    `json:"android_url"`
+		PasswordHint    *string    `json:"password_hint"`
+		PathForward     *bool      `json:"path_forward"`
+		ExpireAfterIdle *string    `json:"expire_after_idle"`
+		ForwardQuery    *bool      `json:"forward_query"`
+		ParamSpec       *paramSpec `json:"param_spec"` // {} clears it
+		RemoveOGImage   bool       `json:"remove_og_image_upload"`
+	}
+	upload, err := decodeLinkBody(w, r, &body)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	existing, err := getRecord(code)
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, "not found")
+		return
+	} else if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+
+	if body.LongURL != nil && strings.TrimSpace(*body.LongURL) == "" {
+		jsonError(w, http.StatusBadRequest, "long_url cannot be empty")
+		return
+	}
+	if body.LongURL != nil {
+		if err := checkDestinationHost(strings.TrimSpace(*body.LongURL)); err != nil {
+			jsonError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		if err := checkTemplateURL(strings.TrimSpace(*body.LongURL)); err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// Sanitize redirect_type
+	if body.RedirectType != nil {
+		rt := sanitizeRedirectType(*body.RedirectType)
+		body.RedirectType = &rt
+	}
+
+	if body.RedirectStatus != nil && !validRedirectStatus(*body.RedirectStatus) {
+		jsonError(w, http.StatusBadRequest, "redirect_status must be 301, 302, 307 or 308")
+		return
 	}
 
 	// Validate expires_at if provided
@@ -401,62 +1046,113 @@ func urlsPatchHandler(w http.ResponseWriter, r *http.Request, code string) {
 			return
 		}
 	}
+	if body.MaxUses != nil && *body.MaxUses < 0 {
+		zero := 0
+		body.MaxUses = &zero
+	}
+	if body.CacheTTL != nil && *body.CacheTTL < -1 {
+		jsonError(w, http.StatusBadRequest, "cache_ttl must be seconds (0 = no-store, -1 = default)")
+		return
+	}
+	if err := checkUTM(body.UTMSource, body.UTMMedium, body.UTMCampaign); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := checkAppURL("ios_url", body.IOSURL); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := checkAppURL("android_url", body.AndroidURL); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// An applink must keep an app URL once the patch is applied.
+	if err := checkAppLink(*cmp.Or(body.RedirectType, &existing.RedirectType), *cmp.Or(body.IOSURL, &existing.IOSURL), *cmp.Or(body.AndroidURL, &existing.AndroidURL)); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := checkPasswordHint(body.PasswordHint); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := checkExpireAfterIdle(body.ExpireAfterIdle); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	longURL := existing.LongURL
+	if body.LongURL != nil {
+		longURL = strings.TrimSpace(*body.LongURL)
+	}
+	if err := checkParamSpec(longURL, body.ParamSpec); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	// Compute password hash if provided
 	var passwordHash *string
 	if body.Password != nil {
 		h := ""
 		if *body.Password != "" {
-			h = hashPassword(*body.Password)
+			if err := checkPasswordStrength(*body.Password); err != nil {
+				jsonError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if h, err = hashLinkPassword(*body.Password); err != nil {
+				jsonError(w, http.StatusBadRequest, err.Error())
+				return
+			}
 		}
 		passwordHash = &h
 	}
 
-	// Rename: INSERT with new code (preserving created_at) then DELETE old (code is PK)
+	var tags *tagList
+	if body.Tags != nil {
+		t, err := linkTags(*body.Tags)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		tags = &t
+	}
+
+	patch := urlPatch{
+		LongURL:         body.LongURL,
+		PublicEnabled:   body.PublicEnabled,
+		InternalEnabled: body.InternalEnabled,
+		RedirectType:    body.RedirectType,
+		RedirectStatus:  body.RedirectStatus,
+		OGTitle:         body.OGTitle,
+		OGDescription:   body.OGDescription,
+		OGImage:         body.OGImage,
+		PasswordHash:    passwordHash,
+		Description:     body.Description,
+		ExpiresAt:       body.ExpiresAt,
+		MaxUses:         body.MaxUses,
+		CacheTTL:        body.CacheTTL,
+		NoAnalytics:     body.NoAnalytics,
+		Tags:            tags,
+		UTMSource:       body.UTMSource,
+		UTMMedium:       body.UTMMedium,
+		UTMCampaign:     body.UTMCampaign,
+		IOSURL:          body.IOSURL,
+		AndroidURL:      body.AndroidURL,
+		PasswordHint:    body.PasswordHint,
+		PathForward:     body.PathForward,
+		ExpireAfterIdle: body.ExpireAfterIdle,
+		ForwardQuery:    body.ForwardQuery,
+		ParamSpec:       body.ParamSpec,
+	}
+
+	// Rename: move the row to the new code (preserving created_at) then apply the patch to it
 	if body.NewCode != nil {
 		newCode := strings.TrimSpace(*body.NewCode)
 		if !validCode.MatchString(newCode) {
 			jsonError(w, http.StatusBadRequest, "code must be 1–32 chars: letters, numbers, hyphens, underscores")
 			return
 		}
-		lu := rec.LongURL
-		if body.LongURL != nil {
-			lu = *body.LongURL
-		}
-		rt := rec.RedirectType
-		if body.RedirectType != nil {
-			rt = *body.RedirectType
-		}
-		ogt := rec.OGTitle
-		if body.OGTitle != nil {
-			ogt = *body.OGTitle
-		}
-		ogd := rec.OGDescription
-		if body.OGDescription != nil {
-			ogd = *body.OGDescription
-		}
-		ogi := rec.OGImage
-		if body.OGImage != nil {
-			ogi = *body.OGImage
-		}
-		opw := rec.PasswordHash
-		if passwordHash != nil {
-			opw = *passwordHash
-		}
-		odesc := rec.Description
-		if body.Description != nil {
-			odesc = *body.Description
-		}
-		oexp := rec.ExpiresAt
-		if body.ExpiresAt != nil {
-			oexp = *body.ExpiresAt
-		}
-		omaxu := rec.MaxUses
-		if body.MaxUses != nil {
-			omaxu = *body.MaxUses
-			if omaxu < 0 {
-				omaxu = 0
-			}
+		if blockedCode(newCode) {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("code '%s' is not allowed", newCode))
+			return
 		}
 		tx, err := db.Begin()
 		if err != nil {
@@ -464,18 +1160,23 @@ func urlsPatchHandler(w http.ResponseWriter, r *http.Request, code string) {
 			return
 		}
 		defer tx.Rollback()
-		if _, err := tx.Exec(
-			"INSERT INTO urls (code, long_url, public_enabled, internal_enabled, redirect_type, og_title, og_description, og_image, password_hash, description, expires_at, max_uses, use_count, created_at) SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0, created_at FROM urls WHERE code = ?",
-			newCode, lu, boolToInt(nextPub), boolToInt(nextInt), rt, ogt, ogd, ogi, opw, odesc, oexp, omaxu, code,
-		); err != nil {
-			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		if err := renameURL(tx, code, newCode); err != nil {
+			if isUniqueViolation(err) {
 				jsonError(w, http.StatusConflict, fmt.Sprintf("code '%s' is already taken", newCode))
 			} else {
 				jsonError(w, http.StatusInternalServerError, "database error")
 			}
 			return
 		}
-		if _, err := tx.Exec("DELETE FROM urls WHERE code = ?", code); err != nil {
+		if err := updateURL(tx, newCode, patch); err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if err := logAudit(tx, newCode, auditRename, code, newCode, clientIP(r)); err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if err := auditPatch(tx, newCode, existing, body.LongURL, body.PublicEnabled, body.InternalEnabled, clientIP(r)); err != nil {
 			jsonError(w, http.StatusInternalServerError, "database error")
 			return
 		}
@@ -483,13 +1184,24 @@ func urlsPatchHandler(w http.ResponseWriter, r *http.Request, code string) {
 			jsonError(w, http.StatusInternalServerError, "database error")
 			return
 		}
-		w.WriteHeader(http.StatusNoContent)
-		return
-	}
-
-	if err := updateURL(code, body.LongURL, body.PublicEnabled, body.InternalEnabled, body.RedirectType, body.OGTitle, body.OGDescription, body.OGImage, passwordHash, body.Description, body.ExpiresAt, body.MaxUses); err != nil {
+		markChanged()
+		forgetRecord(code, newCode)
+		code = newCode
+	} else if err := updateURL(db, code, patch); err != nil {
 		jsonError(w, http.StatusInternalServerError, "database error")
 		return
+	} else if err := auditPatch(db, code, existing, body.LongURL, body.PublicEnabled, body.InternalEnabled, clientIP(r)); err != nil {
+		log.Printf("audit %s: %v", code, err)
+	}
+	if upload != nil || (body.RemoveOGImage && existing.OGImageFile != "") {
+		if err := setOGImage(code, upload); err != nil {
+			log.Printf("store og image %s: %v", code, err)
+			jsonError(w, http.StatusInternalServerError, "could not store og_image_file")
+			return
+		}
+	}
+	if body.LongURL != nil && (*body.LongURL != existing.LongURL || existing.Title == "") {
+		fetchTitle(code, *body.LongURL)
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -499,28 +1211,39 @@ func settingsHandler(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		pb, ph, uh, ih, ah := cfg.snapshot()
 		papiHost := cfg.publicAPIHostVal()
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"public_base":     pb,
-			"public_host":     ph,
-			"ui_host":         uh,
-			"internal_host":   ih,
-			"alias_host":      ah,
-			"public_api_host": papiHost,
-		})
+		resp := cfg.runtimeSettingsJSON()
+		resp["public_base"] = pb
+		resp["public_host"] = ph
+		resp["ui_host"] = uh
+		resp["internal_host"] = ih
+		resp["alias_host"] = ah
+		resp["alias_hosts"] = splitAliasHosts(ah)
+		resp["public_api_host"] = papiHost
+		// Read-only: set through the environment at startup.
+		resp["code_len"] = codeLen
+		resp["code_charset"] = charset
+		resp["code_grow_after"] = codeGrowAfter
+		writeJSON(w, r, http.StatusOK, resp)
 
 	case http.MethodPatch:
 		var body struct {
-			PublicBase    *string `json:"public_base"`
-			UIHost        *string `json:"ui_host"`
-			InternalHost  *string `json:"internal_host"`
-			AliasHost     *string `json:"alias_host"`
-			PublicAPIHost *string `json:"public_api_host"`
+			PublicBase    *string   `json:"public_base"`
+			UIHost        *string   `json:"ui_host"`
+			InternalHost  *string   `json:"internal_host"`
+			AliasHost     *string   `json:"alias_host"`
+			AliasHosts    *[]string `json:"alias_hosts"`
+			PublicAPIHost *string   `json:"public_api_host"`
 		}
-		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		raw, err := io.ReadAll(r.Body)
+		if err != nil || json.Unmarshal(raw, &body) != nil {
 			jsonError(w, http.StatusBadRequest, "invalid JSON")
 			return
 		}
+		extra, err := parseRuntimeSettings(raw)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		pb, _, uh, ih, ah := cfg.snapshot()
 		papiHost := cfg.publicAPIHostVal()
 		if body.PublicBase != nil {
@@ -533,11 +1256,18 @@ func settingsHandler(w http.ResponseWriter, r *http.Request) {
 			ih = *body.InternalHost
 		}
 		if body.AliasHost != nil {
-			ah = *body.AliasHost
+			ah = normalizeAliasHosts([]string{*body.AliasHost})
+		}
+		if body.AliasHosts != nil {
+			ah = normalizeAliasHosts(*body.AliasHosts)
 		}
 		if body.PublicAPIHost != nil {
 			papiHost = *body.PublicAPIHost
 		}
+		if err := checkHostCollisions(pb, uh, ih, ah, papiHost); err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		cfg.apply(pb, uh, ih, ah, papiHost)
 		for k, v := range map[string]string{
 			"public_base":     pb,
@@ -551,6 +1281,20 @@ func settingsHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 		}
+		cfg.setSettings(extra)
+		for k, v := range extra {
+			if err := saveSetting(k, v); err != nil {
+				jsonError(w, http.StatusInternalServerError, "failed to save setting")
+				return
+			}
+		}
+		// Link JSON carries URLs and display times built from the settings.
+		markChanged()
+		// A new password invalidates every session, including this one;
+		// keep the admin who set it logged in.
+		if pw, ok := extra["admin_password"]; ok && pw != "" {
+			setSessionCookie(w, r)
+		}
 		w.WriteHeader(http.StatusNoContent)
 
 	default:
@@ -558,12 +1302,14 @@ func settingsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// passLimiter counts wrong /pass/ passwords per link and client IP.
+var passLimiter = newRateLimiter(passMaxFailures, passFailureWindow)
+
 func passHandler(w http.ResponseWriter, r *http.Request) {
-	// CORS: allow the public base URL and alias host to call this endpoint
+	// CORS: allow the public base URL and alias hosts to call this endpoint
 	// (JS redirect pages served from those domains POST here cross-origin).
 	pb, _, _, _, _ := cfg.snapshot()
-	ab := cfg.aliasBase()
-	if origin := r.Header.Get("Origin"); isAllowedOrigin(origin, pb, ab) {
+	if origin := r.Header.Get("Origin"); isAllowedOrigin(origin, pb, cfg.aliasBases()) {
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
@@ -598,31 +1344,109 @@ func passHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-	if rec.ExpiresAt != "" {
-		if t, err := time.Parse(time.RFC3339, rec.ExpiresAt); err == nil && time.Now().UTC().After(t) {
-			jsonError(w, http.StatusGone, "this link has expired")
-			return
-		}
+	if gone, _ := linkExpiry(rec.ExpiresAt); gone {
+		jsonError(w, http.StatusGone, "this link has expired")
+		return
+	}
+	if idle, err := linkIdleExpired(code, rec.ExpireAfterIdle); err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	} else if idle {
+		jsonError(w, http.StatusGone, "this link has expired")
+		return
 	}
 	if rec.PasswordHash == "" {
 		jsonError(w, http.StatusBadRequest, "no password set")
 		return
 	}
-	if hashPassword(body.Password) != rec.PasswordHash {
+	limitKey := code + "|" + clientIP(r)
+	if blocked, retry := passLimiter.exceeded(limitKey); blocked {
+		passAttemptsTotal.WithLabelValues("rate_limited").Inc()
+		backoffResponse(w, http.StatusTooManyRequests, "rate_limited", "too many incorrect passwords", retry)
+		return
+	}
+	if !linkPasswordOK(rec.PasswordHash, rec.PasswordAlgo, body.Password) {
+		passAttemptsTotal.WithLabelValues("fail").Inc()
+		passLimiter.hit(limitKey)
 		jsonError(w, http.StatusUnauthorized, "incorrect password")
 		return
 	}
+	passAttemptsTotal.WithLabelValues("success").Inc()
+	passLimiter.reset(limitKey)
+	if rec.PasswordAlgo == passwordAlgoSHA256 {
+		upgradePasswordHash(code, rec.PasswordHash, body.Password)
+	}
+	if ok, err := incrementUseCount(code, rec.MaxUses); err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	} else if !ok {
+		jsonError(w, http.StatusGone, "this link has reached its use limit")
+		return
+	}
+	touchLastAccessed(code)
+	if !rec.NoAnalytics {
+		recordClick(r, code, outcomeRedirected)
+		notifyClick(code, rec.destination(), redirectHostType(r, routeOf(r) == routeInternal), r.UserAgent())
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"url": rec.LongURL})
+	json.NewEncoder(w).Encode(map[string]string{"url": rec.destination()})
 }
 
+// qrHandler serves /qr/{code}. By default the QR encodes the public short
+// URL; ?encode=destination encodes the resolved destination instead, which
+// bypasses the redirect (and so its click tracking) entirely. That is only
+// allowed for live public links without a password or use limit.
+//
+// ?host=public|alias|internal picks the short URL to encode instead of the
+// default (alias if configured, else public); it 404s when the link is off
+// on that host.
+//
+// ?size= (pixels, clamped to qrMinSize–qrMaxSize; default 512), ?level=
+// L|M|Q|H (error recovery; default Q) and ?format=png|svg shape the image.
 func qrHandler(w http.ResponseWriter, r *http.Request) {
 	code := strings.TrimPrefix(r.URL.Path, "/qr/")
 	if code == "" {
 		http.NotFound(w, r)
 		return
 	}
-	rec, err := getRecord(code)
+	q := r.URL.Query()
+	encode := q.Get("encode")
+	if encode != "" && encode != "short" && encode != "destination" {
+		http.Error(w, "encode must be short or destination", http.StatusBadRequest)
+		return
+	}
+	size := 512
+	if v := q.Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "size must be an integer", http.StatusBadRequest)
+			return
+		}
+		size = min(max(n, qrMinSize), qrMaxSize)
+	}
+	level := qrcode.High
+	if v := q.Get("level"); v != "" {
+		var ok bool
+		if level, ok = qrLevels[strings.ToUpper(v)]; !ok {
+			http.Error(w, "level must be L, M, Q or H", http.StatusBadRequest)
+			return
+		}
+	}
+	format := q.Get("format")
+	if format != "" && format != "png" && format != "svg" {
+		http.Error(w, "format must be png or svg", http.StatusBadRequest)
+		return
+	}
+	host := q.Get("host")
+	if host != "" && host != "public" && host != "alias" && host != "internal" {
+		http.Error(w, "host must be public, alias or internal", http.StatusBadRequest)
+		return
+	}
+	if host != "" && encode == "destination" {
+		http.Error(w, "host cannot be combined with encode=destination", http.StatusBadRequest)
+		return
+	}
+	row, err := getURLRow(code)
 	if err == sql.ErrNoRows {
 		http.NotFound(w, r)
 		return
@@ -631,57 +1455,285 @@ func qrHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-	pb, _, _, _, _ := cfg.snapshot()
-	ab := cfg.aliasBase()
-	pubURL := fmt.Sprintf("%s/%s", pb, code)
-	if ab != "" {
-		pubURL = fmt.Sprintf("%s/%s", ab, code)
+
+	var content string
+	cacheControl := "public, max-age=3600"
+	if encode == "destination" {
+		switch {
+		case !row.PublicEnabled:
+			http.Error(w, "public link disabled", http.StatusNotFound)
+			return
+		case row.IsExpired:
+			http.Error(w, "this link has expired", http.StatusGone)
+			return
+		case row.UsesExhausted:
+			http.Error(w, "this link has reached its use limit", http.StatusGone)
+			return
+		case row.HasPassword || row.MaxUses > 0:
+			http.Error(w, "destination QR codes are not available for password-protected or use-limited links", http.StatusForbidden)
+			return
+		}
+		content = row.destination()
+		// The destination can be edited at any time; don't let a stale QR linger.
+		cacheControl = "no-cache"
+	} else {
+		pb, _, _, ih, _ := cfg.snapshot()
+		ab := cfg.aliasBase(r)
+		// An explicit host is gated like the redirect on that host would be.
+		switch host {
+		case "":
+			content = fmt.Sprintf("%s/%s", cmp.Or(ab, pb), code)
+		case "public":
+			if !row.PublicEnabled {
+				http.Error(w, "public link disabled", http.StatusNotFound)
+				return
+			}
+			content = fmt.Sprintf("%s/%s", pb, code)
+		case "alias":
+			if !row.PublicEnabled || ab == "" {
+				http.Error(w, "alias link not available", http.StatusNotFound)
+				return
+			}
+			content = fmt.Sprintf("%s/%s", ab, code)
+		case "internal":
+			if !row.InternalEnabled {
+				http.Error(w, "internal link disabled", http.StatusNotFound)
+				return
+			}
+			content = fmt.Sprintf("%s/%s", ih, code)
+		}
 	}
-	_ = rec // record exists; use its public URL
-	png, err := qrcode.Encode(pubURL, qrcode.High, 512)
+	qr, err := qrcode.New(content, level)
 	if err != nil {
 		http.Error(w, "qr error", http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "image/png")
-	w.Header().Set("Cache-Control", "public, max-age=3600")
-	w.Write(png)
+	var img []byte
+	if format == "svg" {
+		img = qrSVG(qr.Bitmap(), size)
+		w.Header().Set("Content-Type", "image/svg+xml")
+	} else {
+		if img, err = qr.PNG(size); err != nil {
+			http.Error(w, "qr error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Write(img)
 }
 
-func doRedirect(w http.ResponseWriter, r *http.Request, code string, internal bool) {
-	rec, err := getRecord(code)
+const (
+	qrMinSize = 64
+	qrMaxSize = 2048
+)
+
+// qrLevels maps the standard recovery level letters to go-qrcode's names,
+// which are shifted by one: its High is Q (25%), Highest is H (30%).
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// qrSVG draws a QR bitmap (quiet zone included) as one SVG path, one unit
+// per module, scaled to size pixels by the viewBox.
+func qrSVG(bitmap [][]bool, size int) []byte {
+	n := len(bitmap)
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x := 0; x < n; x++ {
+			if !row[x] {
+				continue
+			}
+			// Merge each horizontal run of dark modules into one rectangle.
+			start := x
+			for x < n && row[x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	return fmt.Appendf(nil, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="%d" height="%d" fill="#fff"/><path d="%s" fill="#000"/></svg>`,
+		size, size, n, n, n, n, path.String())
+}
+
+var graceTmpl = template.Must(template.New("grace").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<meta http-equiv="refresh" content="5; url={{.LongURL}}">
+<meta name="robots" content="noindex,nofollow">
+<title>This link has expired</title>
+<style>:root{color-scheme:light dark}body{margin:0;min-height:100vh;display:flex;align-items:center;justify-content:center;background-color:Canvas;color:CanvasText;font-family:system-ui,sans-serif;font-size:.9rem;text-align:center}a{color:LinkText}</style>
+</head>
+<body><div><p style="font-size:1.1rem">⏳ This link expired at {{.ExpiredAt}}.</p>
+<p>It still works until {{.GraceEnd}} — update your bookmark.</p>
+<p>Redirecting in a few seconds… <a href="{{.LongURL}}">continue now</a></p></div></body>
+</html>`))
+
+// linkExpiry reports whether a link with the given expires_at is past its
+// expiry plus the expiry_grace setting (gone), or, when it is expired but
+// still inside the grace window, the time access ends (otherwise zero).
+func linkExpiry(expiresAt string) (gone bool, graceEnd time.Time) {
+	if expiresAt == "" {
+		return false, time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return false, time.Time{}
+	}
+	now := time.Now().UTC()
+	if !now.After(t) {
+		return false, time.Time{}
+	}
+	end := t.Add(cfg.duration("expiry_grace")).UTC()
+	if !now.Before(end) {
+		return true, time.Time{}
+	}
+	return false, end
+}
+
+// doRedirect serves path (the request path without its leading slash): the
+// link named by its first segment, with anything below it forwarded when the
+// link has path_forward (see forwardPath) and the request's query merged in
+// when it has forward_query (see mergeQuery). On the internal host a name with
+// no link of its own falls back to the longest template link prefix (see
+// findTemplateLink); a template link with a param_spec answers 400 to a query
+// that breaks it.
+func doRedirect(w http.ResponseWriter, r *http.Request, path string, internal bool) {
+	start, outcome := time.Now(), ""
+	defer func() { observeRedirect(redirectHostType(r, internal), outcome, time.Since(start)) }()
+	code, rest, forwarded := strings.Cut(path, "/")
+	rec, err := cachedRecord(code)
+	arg := ""
+	if err == sql.ErrNoRows && internal {
+		var prefix string
+		if prefix, rec, err = findTemplateLink(code); err == nil {
+			code, arg = prefix, strings.TrimPrefix(code, prefix)
+		}
+	}
+	templated := err == nil && isTemplateURL(rec.LongURL)
+	if templated {
+		rec.LongURL = fillTemplate(rec.LongURL, arg)
+	}
+	// forward_query merges the query itself, so path_forward then only
+	// forwards the path.
+	query := r.URL.RawQuery
+	if err == nil && rec.ForwardQuery {
+		query = ""
+	}
+	if err == nil && rec.PathForward {
+		var ok bool
+		if rec.LongURL, ok = forwardPath(rec.LongURL, rest, query); !ok {
+			err = sql.ErrNoRows
+		}
+	} else if err == nil && forwarded {
+		err = sql.ErrNoRows
+	}
+	if err == nil && rec.ForwardQuery {
+		rec.LongURL = mergeQuery(rec.LongURL, r.URL.RawQuery, cfg.enabled("forward_query_prefer_destination"))
+	}
 	if err == sql.ErrNoRows {
-		http.Error(w, "short URL not found", http.StatusNotFound)
+		outcome = outcomeNotFound
+		recordClick(r, path, outcomeNotFound)
+		if typoResponse(w, path, internal) {
+			return
+		}
+		linkUnavailable(w, r, internal, http.StatusNotFound, "short URL not found")
 		return
 	}
 	if err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	// Links with no_analytics are never written to the clicks table;
+	// use-count enforcement below still applies.
+	track := func(o string) {
+		outcome = o
+		if !rec.NoAnalytics {
+			recordClick(r, code, o)
+		}
+	}
 	if internal && !rec.InternalEnabled {
-		http.Error(w, "internal link disabled", http.StatusNotFound)
+		track(outcomeDisabled)
+		linkUnavailable(w, r, internal, http.StatusNotFound, "internal link disabled")
 		return
 	}
 	if !internal && !rec.PublicEnabled {
-		http.Error(w, "public link disabled", http.StatusNotFound)
+		track(outcomeDisabled)
+		linkUnavailable(w, r, internal, http.StatusNotFound, "public link disabled")
 		return
 	}
-	if rec.ExpiresAt != "" {
-		if t, err := time.Parse(time.RFC3339, rec.ExpiresAt); err == nil && time.Now().UTC().After(t) {
-			http.Error(w, "this link has expired", http.StatusGone)
+	gone, graceEnd := linkExpiry(rec.ExpiresAt)
+	if !gone {
+		if gone, err = linkIdleExpired(code, rec.ExpireAfterIdle); err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
 	}
-	if ok, err := incrementUseCount(code, rec.MaxUses); err != nil {
+	if gone {
+		track(outcomeExpired)
+		linkUnavailable(w, r, internal, http.StatusGone, "this link has expired")
+		return
+	}
+	if templated {
+		if err := rec.ParamSpec.check(r.URL.Query()); err != nil {
+			track(outcomeBadParams)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	// Password links only use up a visit once passHandler has verified the
+	// password; rendering the prompt merely checks the limit.
+	passwordGated := rec.RedirectType == "js" && rec.PasswordHash != ""
+	if passwordGated {
+		if rec.MaxUses > 0 && rec.UseCount >= rec.MaxUses {
+			track(outcomeExhausted)
+			linkUnavailable(w, r, internal, http.StatusGone, "this link has reached its use limit")
+			return
+		}
+	} else if ok, err := incrementUseCount(code, rec.MaxUses); err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	} else if !ok {
-		http.Error(w, "this link has reached its use limit", http.StatusGone)
+		track(outcomeExhausted)
+		linkUnavailable(w, r, internal, http.StatusGone, "this link has reached its use limit")
 		return
 	}
-	if rec.RedirectType == "meta" || rec.RedirectType == "js" {
+	dest := rec.destination()
+	if passwordGated {
+		track(outcomePasswordRequired)
+	} else {
+		track(outcomeRedirected)
+		touchLastAccessed(code)
+		if !rec.NoAnalytics {
+			notifyClick(code, dest, redirectHostType(r, internal), r.UserAgent())
+		}
+	}
+	setRedirectCacheControl(w, rec)
+	interstitial := rec.RedirectType != "redirect" || !graceEnd.IsZero()
+	// Never for password links: the header would reveal the destination.
+	if interstitial && rec.PasswordHash == "" && cfg.enabled("canonical_link") {
+		w.Header().Set("Link", "<"+dest+`>; rel="canonical"`)
+	}
+	if !graceEnd.IsZero() {
+		w.Header().Set("Warning", fmt.Sprintf(`299 - "link expired; access ends %s"`, graceEnd.Format(time.RFC3339)))
+		// Password links keep their own page (the warning header still applies);
+		// everything else gets a short interstitial before redirecting.
+		if rec.PasswordHash == "" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			graceTmpl.Execute(w, struct {
+				LongURL, ExpiredAt, GraceEnd string
+			}{dest, rec.ExpiresAt, graceEnd.Format(time.RFC3339)})
+			return
+		}
+	}
+	if rec.RedirectType == "meta" || rec.RedirectType == "js" || rec.RedirectType == "applink" {
 		pb, _, uh, _, _ := cfg.snapshot()
-		ab := cfg.aliasBase()
+		ab := cfg.aliasBase(r)
 		shortURL := fmt.Sprintf("%s/%s", pb, code)
 		if ab != "" {
 			shortURL = fmt.Sprintf("%s/%s", ab, code)
@@ -701,18 +1753,87 @@ func doRedirect(w http.ResponseWriter, r *http.Request, code string, internal bo
 			}
 			passURL = apiBase + "/pass/" + code
 		}
-		tmpl := metaRedirectTmpl
-		if rec.RedirectType == "js" {
-			tmpl = jsRedirectTmpl
+		// Point scrapers at our own copy of the image: the upload, or the
+		// og_image URL through the proxy (which falls back to redirecting).
+		ogImage := rec.OGImage
+		if rec.OGImageFile != "" {
+			ogImage = ogImageURL(requestScheme(r)+"://"+effectiveHost(r), code)
+		} else if ogImage != "" {
+			ogImage = ogProxyURL(requestScheme(r)+"://"+effectiveHost(r), code)
+		}
+		// Templates get no destination for password links, so one that
+		// ignores .HasPassword cannot hand it out.
+		pageDest := dest
+		if rec.PasswordHash != "" {
+			pageDest = ""
 		}
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		tmpl.Execute(w, struct {
-			LongURL, ShortURL, OGTitle, OGDescription, OGImage, Code, PassURL string
-			HasPassword                                                        bool
-		}{rec.LongURL, shortURL, rec.OGTitle, rec.OGDescription, rec.OGImage, code, passURL, rec.PasswordHash != ""})
+		renderRedirectPage(w, rec.RedirectType, redirectPageData{pageDest, shortURL, rec.OGTitle, rec.OGDescription, ogImage, code, passURL, rec.IOSURL, rec.AndroidURL, rec.PasswordHint, rec.PasswordHash != "", appLinkFallbackMs})
 		return
 	}
-	http.Redirect(w, r, rec.LongURL, http.StatusFound)
+	// Tell clients that follow the redirect which short link they came through.
+	w.Header().Set("Link", "<"+requestShortURL(r, code, internal)+`>; rel="canonical"`)
+	w.Header().Set("X-Short-Code", code)
+	http.Redirect(w, r, dest, cmp.Or(rec.RedirectStatus, defaultRedirectStatus))
+}
+
+// requestShortURL is code's short URL on the kind of host r came in on: the
+// internal host, the alias host it used, or the public base.
+func requestShortURL(r *http.Request, code string, internal bool) string {
+	pb, _, _, ih, _ := cfg.snapshot()
+	switch {
+	case internal:
+		return strings.TrimRight(ih, "/") + "/" + code
+	case routeOf(r) == routeAlias:
+		return cfg.aliasBase(r) + "/" + code
+	}
+	return pb + "/" + code
+}
+
+// escapeDestination percent-encodes the bytes of a stored destination that are
+// not valid in a URL (spaces, quotes, non-ASCII …) while leaving its structure —
+// including any #fragment — untouched. This keeps the fragment intact in the
+// Location header and stops it from being cut short inside the meta refresh
+// content attribute. A second '#' is encoded so only the first delimits the fragment.
+func escapeDestination(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	seenHash := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '#' && !seenHash:
+			seenHash = true
+			b.WriteByte(c)
+		case c <= ' ' || c >= 0x7f || strings.IndexByte("\"'<>\\^`{|}#", c) >= 0:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// setRedirectCacheControl applies the link's cache_ttl (or the global default).
+// Gated links — password, use limit or expiry — are always no-store so every
+// hit reaches the server and the gate is enforced.
+func setRedirectCacheControl(w http.ResponseWriter, rec urlRecord) {
+	ttl := rec.CacheTTL
+	if ttl < 0 {
+		ttl = redirectCacheTTL
+	}
+	if rec.PasswordHash != "" || rec.MaxUses > 0 || rec.ExpiresAt != "" {
+		ttl = 0
+	}
+	switch {
+	case ttl < 0:
+		// No default configured: leave caching to the client.
+	case ttl == 0:
+		w.Header().Set("Cache-Control", "no-store")
+	default:
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", ttl))
+	}
 }
 
 var staticFS = func() http.Handler {
@@ -724,41 +1845,161 @@ var staticFS = func() http.Handler {
 }()
 
 // apiRouter serves the management API — used by both the UI host and internal host.
-// Returns true if the request was handled.
+// Returns true if the request was handled. Management endpoints need an
+// admin login when ADMIN_PASSWORD is set; the public ones never do.
 func apiRouter(w http.ResponseWriter, r *http.Request) bool {
+	if h := openAPIRoute(r); h != nil {
+		h(w, r)
+		return true
+	}
+	h := adminAPIRoute(r)
+	if h == nil {
+		return false
+	}
+	if requireAdmin(w, r) {
+		h(w, r)
+	}
+	return true
+}
+
+// openAPIRoute returns the handler for r's path among the endpoints that
+// stay reachable without a login, or nil.
+func openAPIRoute(r *http.Request) http.HandlerFunc {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/qr/"):
+		return qrHandler
+	case strings.HasPrefix(r.URL.Path, "/pass/"):
+		return passHandler
+	case strings.HasPrefix(r.URL.Path, "/embed/"):
+		return embedHandler
+	case r.URL.Path == "/oembed":
+		return oembedHandler
+	case strings.HasPrefix(r.URL.Path, "/hook/"):
+		return hookHandler
+	case strings.HasPrefix(r.URL.Path, "/ogimg/"):
+		return ogImageHandler
+	case strings.HasPrefix(r.URL.Path, "/og-image/"):
+		return ogProxyHandler
+	case strings.HasPrefix(r.URL.Path, "/preview/"):
+		return previewHandler
+	case strings.HasPrefix(r.URL.Path, "/badge/"):
+		return badgeHandler
+	case r.URL.Path == "/login":
+		return loginHandler
+	case r.URL.Path == "/logout":
+		return logoutHandler
+	}
+	return nil
+}
+
+// adminAPIRoute returns the handler for r's path among the management
+// endpoints, or nil.
+func adminAPIRoute(r *http.Request) http.HandlerFunc {
 	switch {
 	case r.URL.Path == "/shorten":
-		shortenHandler(w, r)
+		return shortenHandler
+	case r.URL.Path == "/shorten/bulk":
+		return shortenBulkHandler
+	case r.URL.Path == "/urls":
+		return urlsListHandler
+	case r.URL.Path == "/urls/tag" && r.Method == http.MethodPost:
+		return tagBulkHandler
+	case r.URL.Path == "/urls/batch" && r.Method == http.MethodPost:
+		return urlsBatchHandler
+	case r.URL.Path == "/urls/expiring" && r.Method == http.MethodGet:
+		return urlsExpiringHandler
 	case strings.HasPrefix(r.URL.Path, "/urls/"):
-		urlsHandler(w, r)
+		return urlsHandler
+	case r.URL.Path == "/import":
+		return importHandler
+	case r.URL.Path == "/export":
+		return exportHandler
 	case r.URL.Path == "/settings":
-		settingsHandler(w, r)
-	case strings.HasPrefix(r.URL.Path, "/qr/"):
-		qrHandler(w, r)
-	case strings.HasPrefix(r.URL.Path, "/pass/"):
-		passHandler(w, r)
-	default:
-		return false
-	}
-	return true
+		return settingsHandler
+	case r.URL.Path == "/redirect-types":
+		return redirectTypesHandler
+	case strings.HasPrefix(r.URL.Path, "/available/"):
+		return availableHandler
+	case r.URL.Path == "/stats" || strings.HasPrefix(r.URL.Path, "/stats/"):
+		return statsHandler
+	case r.URL.Path == "/metrics":
+		return metricsHandler
+	case r.URL.Path == "/tokens" || strings.HasPrefix(r.URL.Path, "/tokens/"):
+		return tokensHandler
+	case r.URL.Path == "/trash":
+		return trashHandler
+	}
+	return nil
 }
 
-// publicAPIRouter: public API host — serves /pass/ and /qr/ endpoints only.
+// publicAPIRouter: public API host — serves /pass/, /qr/, /embed/, /oembed, /hook/, /ogimg/, /og-image/,
+// /preview/, /badge/, and /shorten and /urls/{code} for cross-origin front-ends (see publicAPILinks).
 func publicAPIRouter(w http.ResponseWriter, r *http.Request) {
 	switch {
+	case r.URL.Path == "/shorten" || strings.HasPrefix(r.URL.Path, "/urls/"):
+		publicAPILinks(w, r)
 	case strings.HasPrefix(r.URL.Path, "/pass/"):
 		passHandler(w, r)
 	case strings.HasPrefix(r.URL.Path, "/qr/"):
 		qrHandler(w, r)
+	case strings.HasPrefix(r.URL.Path, "/embed/"):
+		embedHandler(w, r)
+	case r.URL.Path == "/oembed":
+		oembedHandler(w, r)
+	case strings.HasPrefix(r.URL.Path, "/hook/"):
+		hookHandler(w, r)
+	case strings.HasPrefix(r.URL.Path, "/ogimg/"):
+		ogImageHandler(w, r)
+	case strings.HasPrefix(r.URL.Path, "/og-image/"):
+		ogProxyHandler(w, r)
+	case strings.HasPrefix(r.URL.Path, "/preview/"):
+		previewHandler(w, r)
+	case strings.HasPrefix(r.URL.Path, "/badge/"):
+		badgeHandler(w, r)
 	default:
 		http.NotFound(w, r)
 	}
 }
 
+// publicAPILinks serves POST /shorten, GET, PATCH and DELETE /urls/{code}
+// and POST /urls/{code}/regenerate on the public API host, with CORS for
+// apiOriginAllowed origins. Creating and reading links is gated by
+// requireAdmin as on the UI host (send the admin password as HTTP Basic
+// auth or an API token); changes to existing links are refused outright unless
+// ADMIN_PASSWORD is set, so an open instance never lets other sites change
+// its links.
+func publicAPILinks(w http.ResponseWriter, r *http.Request) {
+	if origin := r.Header.Get("Origin"); apiOriginAllowed(origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Set("Vary", "Origin")
+	}
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	changes := r.Method == http.MethodPatch || r.Method == http.MethodDelete || (r.Method == http.MethodPost && r.URL.Path != "/shorten")
+	if changes && !adminAuthEnabled() {
+		jsonError(w, http.StatusForbidden, "changing links on the public API host requires ADMIN_PASSWORD")
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.URL.Path == "/shorten" {
+		shortenHandler(w, r)
+	} else {
+		urlsHandler(w, r)
+	}
+}
+
 // uiRouter: web UI host — serves the UI and API, no redirects.
 func uiRouter(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path == "/" {
-		renderIndex(w, r)
+		if requireAdmin(w, r) {
+			renderIndex(w, r)
+		}
 		return
 	}
 	if strings.HasPrefix(r.URL.Path, "/static/") {
@@ -770,20 +2011,126 @@ func uiRouter(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// publicRouter: public redirect host — redirects only, no UI.
+// publicRouter: public redirect host — redirects only, no UI. Uploaded and
+// proxied og:images, link previews and status badges are served here too, so
+// social cards and READMEs need no other host.
 func publicRouter(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/ogimg/") {
+		ogImageHandler(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/og-image/") {
+		ogProxyHandler(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/preview/") {
+		previewHandler(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/badge/") {
+		badgeHandler(w, r)
+		return
+	}
 	code := strings.TrimPrefix(r.URL.Path, "/")
 	if code == "" {
-		http.NotFound(w, r)
+		linkUnavailable(w, r, false, http.StatusNotFound, "short URL not found")
 		return
 	}
 	doRedirect(w, r, code, false)
 }
 
+// resetHandler serves POST /admin/reset: deletes every link, click, audit
+// entry and uploaded og:image. It is only routed on the internal host, behind
+// requireAdmin, is disabled unless ADMIN_RESET_TOKEN is set, and requires the
+// token echoed back as {"confirm": "<token>"}; wrong tokens count against
+// loginLimiter.
+func resetHandler(w http.ResponseWriter, r *http.Request) {
+	if adminResetToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Confirm string `json:"confirm"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	ip := clientIP(r)
+	if blocked, retry := loginLimiter.exceeded(ip); blocked {
+		backoffResponse(w, http.StatusTooManyRequests, "rate_limited", "too many wrong confirm tokens", retry)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(body.Confirm), []byte(adminResetToken)) != 1 {
+		loginLimiter.hit(ip)
+		log.Printf("RESET REJECTED: bad confirm token from %s", ip)
+		jsonError(w, http.StatusForbidden, "confirm does not match ADMIN_RESET_TOKEN")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	defer tx.Rollback()
+	urlsRes, err := tx.Exec("DELETE FROM urls")
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	clicksRes, err := tx.Exec("DELETE FROM clicks")
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM audit_log"); err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	markChanged()
+	forgetAllRecords()
+	// The images belonged to the deleted links; a new link reusing a code
+	// must not serve them.
+	removeAllOGImageFiles()
+	ogProxyCache.clear()
+	nURLs, _ := urlsRes.RowsAffected()
+	nClicks, _ := clicksRes.RowsAffected()
+	log.Printf("RESET: deleted ALL data (%d links, %d clicks) at request of %s", nURLs, nClicks, r.RemoteAddr)
+
+	writeJSON(w, r, http.StatusOK, map[string]int64{"deleted_urls": nURLs, "deleted_clicks": nClicks})
+}
+
 // internalRouter: internal host (e.g. "go") — UI at root, redirects elsewhere.
 func internalRouter(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path == "/" {
-		renderIndex(w, r)
+		if target := cfg.setting("internal_root_redirect"); target != "" {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+		if requireAdmin(w, r) {
+			renderIndex(w, r)
+		}
+		return
+	}
+	if r.URL.Path == "/admin/reset" {
+		if requireAdmin(w, r) {
+			resetHandler(w, r)
+		}
+		return
+	}
+	if r.URL.Path == "/check-urls" {
+		if requireAdmin(w, r) {
+			checkURLsHandler(w, r)
+		}
 		return
 	}
 	if strings.HasPrefix(r.URL.Path, "/static/") {
@@ -797,7 +2144,94 @@ func internalRouter(w http.ResponseWriter, r *http.Request) {
 	doRedirect(w, r, code, true)
 }
 
-func mainHandler(w http.ResponseWriter, r *http.Request) {
+var maintenancePage = []byte(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="UTF-8"><meta name="robots" content="noindex,nofollow"><title>Under maintenance</title>
+<style>:root{color-scheme:light dark}body{margin:0;min-height:100vh;display:flex;align-items:center;justify-content:center;background-color:Canvas;color:CanvasText;font-family:system-ui,sans-serif;font-size:.9rem;text-align:center}</style>
+</head>
+<body><div><p style="font-size:1.1rem">🛠 We're down for maintenance.</p><p>Links will work again shortly — please try later.</p></div></body>
+</html>`)
+
+// maintenanceRetryAfter is the Retry-After hint sent while in maintenance.
+const maintenanceRetryAfter = 5 * time.Minute
+
+// maintenanceResponse shows browsers the maintenance page; other clients get
+// the structured 503 from backoffResponse.
+func maintenanceResponse(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		backoffResponse(w, http.StatusServiceUnavailable, "maintenance", "down for maintenance", maintenanceRetryAfter)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", retryAfterSeconds(maintenanceRetryAfter))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write(maintenancePage)
+}
+
+// maintenanceExempt reports whether r gets through maintenance mode: a
+// signed-in admin (session, Basic auth or an API token on its routes) on the
+// UI or internal host, or /login there so they can sign in. Without
+// ADMIN_PASSWORD the UI host stays open, as it is outside maintenance.
+func maintenanceExempt(r *http.Request, route string) bool {
+	if route != routeUI && route != routeInternal {
+		return false
+	}
+	if !adminAuthEnabled() {
+		return route == routeUI
+	}
+	if r.URL.Path == "/login" || validSession(r) {
+		return true
+	}
+	if _, pw, ok := r.BasicAuth(); ok {
+		ip := clientIP(r)
+		if blocked, _ := loginLimiter.exceeded(ip); blocked {
+			return false
+		}
+		if adminPasswordOK(pw) {
+			return true
+		}
+		loginLimiter.hit(ip)
+		log.Printf("basic auth: wrong password from %s", ip)
+		return false
+	}
+	token, ok := bearerToken(r)
+	return ok && apiTokenRoute(r) && validAPIToken(token)
+}
+
+// backoffResponse is the one shape of "try again later" (503 maintenance,
+// 429 rate limits): a Retry-After header plus {"error", "reason",
+// "retry_after"} so scripted clients can back off without parsing text.
+func backoffResponse(w http.ResponseWriter, status int, reason, msg string, retry time.Duration) {
+	secs := retryAfterSeconds(retry)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", secs)
+	w.WriteHeader(status)
+	n, _ := strconv.Atoi(secs)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":       msg,
+		"reason":      reason,
+		"retry_after": n,
+	})
+}
+
+// retryAfterSeconds rounds d up to whole seconds, at least 1.
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(max(1, int((d+time.Second-1)/time.Second)))
+}
+
+// Route types: which sub-router a request's host maps to (see routeOf).
+const (
+	routeUI        = "ui"
+	routePublic    = "public"
+	routeAlias     = "alias"
+	routeInternal  = "internal"
+	routePublicAPI = "public_api"
+)
+
+// routeOf maps a request's host to its route type, or "" for unknown hosts.
+func routeOf(r *http.Request) string {
 	host := effectiveHost(r)
 	_, ph, uh, ih, ah := cfg.snapshot()
 	papiHost := cfg.publicAPIHostVal()
@@ -806,19 +2240,55 @@ func mainHandler(w http.ResponseWriter, r *http.Request) {
 	// use hostOf() to extract the bare hostname for comparison.
 	uhHost := hostOf(uh)
 	ihHost := hostOf(ih)
-	ahHost := hostOf(ah)
 	papiHostOnly := hostOf(papiHost)
 
 	switch {
 	case uhHost != "" && host == uhHost:
-		uiRouter(w, r)
+		return routeUI
 	case ph != "" && host == ph:
-		publicRouter(w, r)
-	case ahHost != "" && host == ahHost:
-		publicRouter(w, r)
+		return routePublic
+	case isAliasHost(host, ah):
+		return routeAlias
 	case ihHost != "" && host == ihHost:
-		internalRouter(w, r)
+		return routeInternal
 	case papiHostOnly != "" && host == papiHostOnly:
+		return routePublicAPI
+	}
+	return ""
+}
+
+// isAliasHost reports whether host is one of the comma-separated alias hosts.
+func isAliasHost(host, aliasHosts string) bool {
+	for _, a := range splitAliasHosts(aliasHosts) {
+		if h := hostOf(a); h != "" && host == h {
+			return true
+		}
+	}
+	return false
+}
+
+func mainHandler(w http.ResponseWriter, r *http.Request) {
+	if h, ok := healthPaths[r.URL.Path]; ok {
+		h(w, r)
+		return
+	}
+
+	route := routeOf(r)
+	// Maintenance mode takes every host offline for everyone but admins, so
+	// they can keep working and switch the mode off again.
+	if cfg.enabled("maintenance") && !maintenanceExempt(r, route) {
+		maintenanceResponse(w, r)
+		return
+	}
+
+	switch route {
+	case routeUI:
+		noindex(uiRouter)(w, r)
+	case routePublic, routeAlias:
+		publicRouter(w, r)
+	case routeInternal:
+		noindex(internalRouter)(w, r)
+	case routePublicAPI:
 		publicAPIRouter(w, r)
 	default:
 		http.NotFound(w, r)
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// addTestLink stores a public link under code for a test.
+func addTestLink(t *testing.T, code string, rec urlRecord) {
+	t.Helper()
+	rec.PublicEnabled = true
+	if err := saveURL(code, rec); err != nil {
+		t.Fatalf("save %s: %v", code, err)
+	}
+}
+
+// getRedirect runs doRedirect for code on the public host.
+func getRedirect(code string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	doRedirect(w, httptest.NewRequest("GET", "http://localhost/"+code, nil), code, false)
+	return w
+}
+
+func TestRedirectKeepsFragment(t *testing.T) {
+	dests := []struct{ stored, want string }{
+		{"https://example.com/docs#section-2", "https://example.com/docs#section-2"},
+		{"https://example.com/docs?x=1#section-2", "https://example.com/docs?x=1#section-2"},
+		{"https://example.com/a b#top of page", "https://example.com/a%20b#top%20of%20page"},
+		{"https://example.com/#a#b", "https://example.com/#a%23b"},
+	}
+	for _, rt := range []string{"redirect", "meta", "js"} {
+		for i, d := range dests {
+			code := "frag-" + rt + "-" + string(rune('a'+i))
+			addTestLink(t, code, urlRecord{LongURL: d.stored, RedirectType: rt})
+			w := getRedirect(code)
+			body := w.Body.String()
+			switch rt {
+			case "redirect":
+				if got := w.Header().Get("Location"); got != d.want {
+					t.Errorf("%s: Location = %q, want %q", code, got, d.want)
+				}
+			case "meta":
+				if want := `content="0; url=` + d.want + `"`; !strings.Contains(body, want) {
+					t.Errorf("%s: body has no %s:\n%s", code, want, body)
+				}
+			case "js":
+				if want := `window.location.replace("` + d.want + `")`; !strings.Contains(body, want) {
+					t.Errorf("%s: body has no %s:\n%s", code, want, body)
+				}
+			}
+		}
+	}
+}
+
+func TestCanonicalLinkHeader(t *testing.T) {
+	setCanonical := func(on string) { cfg.setSettings(map[string]string{"canonical_link": on}) }
+	t.Cleanup(func() { setCanonical("false") })
+
+	const dest = "https://example.com/article?id=7#comments"
+	const want = `<` + dest + `>; rel="canonical"`
+	for _, rt := range []string{"meta", "js"} {
+		code := "canon-" + rt
+		addTestLink(t, code, urlRecord{LongURL: dest, RedirectType: rt})
+
+		setCanonical("true")
+		if got := getRedirect(code).Header().Get("Link"); got != want {
+			t.Errorf("%s: Link = %q, want %q", rt, got, want)
+		}
+		setCanonical("false")
+		if got := getRedirect(code).Header().Get("Link"); got != "" {
+			t.Errorf("%s with canonical_link off: Link = %q, want none", rt, got)
+		}
+	}
+
+	// The header would reveal a password link's destination.
+	addTestLink(t, "canon-pass", urlRecord{LongURL: dest, RedirectType: "js", PasswordHash: "x"})
+	setCanonical("true")
+	if got := getRedirect("canon-pass").Header().Get("Link"); got != "" {
+		t.Errorf("password link: Link = %q, want none", got)
+	}
+}
+
+func TestPasswordPageHidesDestination(t *testing.T) {
+	const dest = "https://example.com/secret-plans"
+	cfg.setSettings(map[string]string{"js_template": `<script>window.location.replace({{jsStr .LongURL}})</script>`})
+	t.Cleanup(func() { cfg.setSettings(map[string]string{"js_template": ""}) })
+
+	h, err := hashLinkPassword("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestLink(t, "tmpl-pass", urlRecord{LongURL: dest, RedirectType: "js", PasswordHash: h})
+	if body := getRedirect("tmpl-pass").Body.String(); strings.Contains(body, "secret-plans") {
+		t.Errorf("password link page reveals the destination:\n%s", body)
+	}
+	addTestLink(t, "tmpl-open", urlRecord{LongURL: dest, RedirectType: "js"})
+	if body := getRedirect("tmpl-open").Body.String(); strings.Contains(body, "Redirecting") || !strings.Contains(body, "secret-plans") {
+		t.Errorf("open link page is not the js_template with the destination:\n%s", body)
+	}
+}
+
+func TestMaintenanceExemptsOnlyAdmins(t *testing.T) {
+	hash, err := hashLinkPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cfg.setSettings(map[string]string{"admin_password": ""}) })
+	req := func(path, pw string) *http.Request {
+		r := httptest.NewRequest("GET", "http://localhost"+path, nil)
+		if pw != "" {
+			r.SetBasicAuth("admin", pw)
+		}
+		return r
+	}
+
+	if !maintenanceExempt(req("/", ""), routeUI) {
+		t.Error("UI host without ADMIN_PASSWORD is not exempt")
+	}
+	if maintenanceExempt(req("/abc", ""), routeInternal) {
+		t.Error("internal host without ADMIN_PASSWORD is exempt")
+	}
+
+	cfg.setSettings(map[string]string{"admin_password": hash})
+	cases := []struct {
+		route, path, pw string
+		want            bool
+	}{
+		{routeUI, "/", "", false},
+		{routeInternal, "/abc", "", false},
+		{routeUI, "/login", "", true},
+		{routeUI, "/", "secret", true},
+		{routeInternal, "/abc", "secret", true},
+		{routeInternal, "/abc", "wrong", false},
+		{routePublic, "/abc", "secret", false},
+	}
+	for _, c := range cases {
+		if got := maintenanceExempt(req(c.path, c.pw), c.route); got != c.want {
+			t.Errorf("%s %s (password %q): exempt = %v, want %v", c.route, c.path, c.pw, got, c.want)
+		}
+	}
+}
+
+func TestHistoryKeepsOrderWithinASecond(t *testing.T) {
+	addTestLink(t, "hist-order", urlRecord{LongURL: "https://example.com/0"})
+	for i := 1; i <= 3; i++ {
+		logAuditBestEffort("hist-order", auditLongURL, fmt.Sprintf("https://example.com/%d", i-1), fmt.Sprintf("https://example.com/%d", i), "test")
+	}
+	w := httptest.NewRecorder()
+	urlsHistoryHandler(w, httptest.NewRequest("GET", "http://localhost/urls/hist-order/history", nil), "hist-order")
+	var got []auditEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode %s: %v", w.Body, err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d entries, want 3: %s", len(got), w.Body)
+	}
+	for i, e := range got {
+		if want := fmt.Sprintf("https://example.com/%d", 3-i); e.NewValue != want {
+			t.Errorf("entry %d: new_value = %q, want %q", i, e.NewValue, want)
+		}
+	}
+}
+
+func TestTemplateParamSpec(t *testing.T) {
+	spec := paramSpec{Required: []string{"q"}, Allowed: []string{"lang"}}
+	if err := checkParamSpec("https://example.com/", &spec); err == nil {
+		t.Error("param_spec accepted on a link without {*}")
+	}
+	addTestLink(t, "search-", urlRecord{LongURL: "https://example.com/search/{*}", InternalEnabled: true, ForwardQuery: true, ParamSpec: spec})
+	for query, want := range map[string]int{
+		"":             400,
+		"?q=":          400,
+		"?q=x&page=2":  400,
+		"?q=x":         302,
+		"?q=x&lang=en": 302,
+	} {
+		w := httptest.NewRecorder()
+		doRedirect(w, httptest.NewRequest("GET", "http://go/search-go"+query, nil), "search-go", true)
+		if w.Code != want {
+			t.Errorf("search-go%s: status %d, want %d: %s", query, w.Code, want, w.Body)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// hookLimiter throttles POST /hook/{secret} per client IP. It runs before
+// the secret check, so it also slows down guessing.
+var hookLimiter = newRateLimiter(hookRateLimit, time.Minute)
+
+// hookHandler serves POST /hook/{secret}: link creation for systems that can
+// only fire fixed-format webhooks. The body is {"url": "...", "alias": "..."}
+// (alias optional); the link is created with default settings and returned
+// in the same shape as POST /shorten. Disabled unless HOOK_SECRET is set.
+func hookHandler(w http.ResponseWriter, r *http.Request) {
+	if hookSecret == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !hookLimiter.limitRequest(w, r) {
+		return
+	}
+	secret := strings.TrimPrefix(r.URL.Path, "/hook/")
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(hookSecret)) != 1 {
+		log.Printf("hook: bad secret from %s", clientIP(r))
+		http.NotFound(w, r)
+		return
+	}
+
+	var body struct {
+		URL   string `json:"url"`
+		Alias string `json:"alias"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	longURL := strings.TrimSpace(body.URL)
+	if u, err := url.Parse(longURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		jsonError(w, http.StatusBadRequest, "url must be an absolute http(s) URL")
+		return
+	}
+	if utf8.RuneCountInString(longURL) > maxLongURLLen {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("url is longer than %d characters", maxLongURLLen))
+		return
+	}
+	if err := checkDestinationHost(longURL); err != nil {
+		jsonError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err := checkTemplateURL(longURL); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rec := urlRecord{
+		LongURL:         longURL,
+		PublicEnabled:   true,
+		InternalEnabled: true,
+		RedirectType:    sanitizeRedirectType(""),
+		CacheTTL:        -1,
+	}
+	code := strings.TrimSpace(body.Alias)
+	if code != "" {
+		if !validCode.MatchString(code) {
+			jsonError(w, http.StatusBadRequest, "alias must be 1–32 chars: letters, numbers, hyphens, underscores")
+			return
+		}
+		if blockedCode(code) {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("alias '%s' is not allowed", code))
+			return
+		}
+		if err := saveURL(code, rec); isUniqueViolation(err) {
+			jsonError(w, http.StatusConflict, fmt.Sprintf("alias '%s' is already taken", code))
+			return
+		} else if err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+	} else {
+		var err error
+		if code, err = saveURLGenerated(rec); err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+	}
+	logAuditBestEffort(code, auditCreate, "", longURL, clientIP(r))
+	fetchTitle(code, longURL)
+
+	row, err := getURLRow(code)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, linkJSON(row))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"strings"
+	"time"
+)
+
+// expire_after_idle makes a link expire once it has gone that long without a
+// successful redirect: since last_accessed_at, or created_at if it was never
+// used. Unlike expires_at there is no grace period. The cleanup job deletes
+// idle links like expired ones.
+const minExpireAfterIdle = time.Minute
+
+// checkExpireAfterIdle trims an expire_after_idle value and normalizes it to
+// time.Duration's form; empty means never.
+func checkExpireAfterIdle(v *string) error {
+	if v == nil {
+		return nil
+	}
+	if *v = strings.TrimSpace(*v); *v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(*v)
+	if err != nil || d < minExpireAfterIdle {
+		return errors.New("expire_after_idle must be a duration of at least 1m, such as 720h")
+	}
+	*v = d.String()
+	return nil
+}
+
+// idleExpired reports whether a link has been unused for longer than idle.
+func idleExpired(idle, createdAt, lastAccessedAt string) bool {
+	if idle == "" {
+		return false
+	}
+	d, err := time.ParseDuration(idle)
+	if err != nil {
+		return false
+	}
+	last, err := parseStoredTime(cmp.Or(lastAccessedAt, createdAt))
+	if err != nil {
+		return false
+	}
+	return time.Since(last) > d
+}
+
+// linkIdleExpired is idleExpired for the redirect path, which reads links
+// without their timestamps.
+func linkIdleExpired(code, idle string) (bool, error) {
+	if idle == "" {
+		return false, nil
+	}
+	var createdAt, lastAccessedAt string
+	if err := db.QueryRow("SELECT created_at, last_accessed_at FROM urls WHERE code = ?", code).Scan(&createdAt, &lastAccessedAt); err != nil {
+		return false, err
+	}
+	return idleExpired(idle, createdAt, lastAccessedAt), nil
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxImportBytes     = 5 << 20
+	maxLongURLLen      = 2048
+	maxOGTitleLen      = 200
+	maxOGDescLen       = 500
+	maxDescriptionLen  = 500
+	maxUTMLen          = 100
+	maxPasswordHintLen = 200
+)
+
+// importRow is one link in a POST /import upload, in the shape GET /export
+// writes. CSV columns use the same names as the JSON fields (with "url"
+// accepted for long_url, and tags comma-separated); unknown columns are
+// ignored. A blank code gets a generated one.
+type importRow struct {
+	Code            string    `json:"code"`
+	LongURL         string    `json:"long_url"`
+	PublicEnabled   *bool     `json:"public_enabled"`
+	InternalEnabled *bool     `json:"internal_enabled"`
+	RedirectType    string    `json:"redirect_type"`
+	RedirectStatus  int       `json:"redirect_status"` // 0 = 302
+	OGTitle         string    `json:"og_title"`
+	OGDescription   string    `json:"og_description"`
+	OGImage         string    `json:"og_image"`
+	Description     string    `json:"description"`
+	ExpiresAt       string    `json:"expires_at"`
+	MaxUses         int       `json:"max_uses"`
+	UseCount        int       `json:"use_count"`
+	CacheTTL        *int      `json:"cache_ttl"`
+	NoAnalytics     bool      `json:"no_analytics"`
+	Tags            []string  `json:"tags"`
+	UTMSource       string    `json:"utm_source"`
+	UTMMedium       string    `json:"utm_medium"`
+	UTMCampaign     string    `json:"utm_campaign"`
+	IOSURL          string    `json:"ios_url"`
+	AndroidURL      string    `json:"android_url"`
+	PasswordHint    string    `json:"password_hint"`
+	PathForward     bool      `json:"path_forward"`
+	ExpireAfterIdle string    `json:"expire_after_idle"`
+	ForwardQuery    bool      `json:"forward_query"`
+	ParamSpec       paramSpec `json:"param_spec"` // JSON in a CSV cell
+	CreatedAt       string    `json:"created_at"` // kept when set, else now
+
+	err error // set by parseImportCSV for cells that could not be parsed
+}
+
+type importResult struct {
+	Row     int      `json:"row"` // 1-based index of the data row
+	Code    string   `json:"code,omitempty"`
+	Status  string   `json:"status"` // imported, skipped (code exists) or failed
+	Error   string   `json:"error,omitempty"`
+	Applied []string `json:"applied,omitempty"` // optional fields that were set
+}
+
+// record validates the row and converts it into a urlRecord, also returning
+// the optional fields it carries.
+func (in importRow) record() (urlRecord, []string, error) {
+	rec := urlRecord{
+		LongURL:         strings.TrimSpace(in.LongURL),
+		PublicEnabled:   in.PublicEnabled == nil || *in.PublicEnabled,
+		InternalEnabled: in.InternalEnabled == nil || *in.InternalEnabled,
+		RedirectType:    strings.TrimSpace(in.RedirectType),
+		OGTitle:         strings.TrimSpace(in.OGTitle),
+		OGDescription:   strings.TrimSpace(in.OGDescription),
+		OGImage:         strings.TrimSpace(in.OGImage),
+		Description:     strings.TrimSpace(in.Description),
+		UTMSource:       strings.TrimSpace(in.UTMSource),
+		UTMMedium:       strings.TrimSpace(in.UTMMedium),
+		UTMCampaign:     strings.TrimSpace(in.UTMCampaign),
+		IOSURL:          strings.TrimSpace(in.IOSURL),
+		AndroidURL:      strings.TrimSpace(in.AndroidURL),
+		PasswordHint:    in.PasswordHint,
+		ExpireAfterIdle: in.ExpireAfterIdle,
+		CacheTTL:        -1,
+	}
+	if in.err != nil {
+		return rec, nil, in.err
+	}
+	if rec.LongURL == "" {
+		return rec, nil, errors.New("long_url is required")
+	}
+	if err := checkDestinationHost(rec.LongURL); err != nil {
+		return rec, nil, err
+	}
+	if err := checkTemplateURL(rec.LongURL); err != nil {
+		return rec, nil, err
+	}
+	if !rec.PublicEnabled && !rec.InternalEnabled {
+		return rec, nil, errors.New("at least one of public_enabled/internal_enabled must be true")
+	}
+	var applied []string
+	if rec.RedirectType == "" {
+		rec.RedirectType = sanitizeRedirectType("")
+	} else if sanitizeRedirectType(rec.RedirectType) != rec.RedirectType {
+		return rec, nil, fmt.Errorf("unknown redirect_type %q", rec.RedirectType)
+	} else {
+		applied = append(applied, "redirect_type")
+	}
+	for _, f := range []struct {
+		name, value string
+		max         int
+	}{
+		{"long_url", rec.LongURL, maxLongURLLen},
+		{"og_title", rec.OGTitle, maxOGTitleLen},
+		{"og_description", rec.OGDescription, maxOGDescLen},
+		{"og_image", rec.OGImage, maxLongURLLen},
+		{"description", rec.Description, maxDescriptionLen},
+		{"utm_source", rec.UTMSource, maxUTMLen},
+		{"utm_medium", rec.UTMMedium, maxUTMLen},
+		{"utm_campaign", rec.UTMCampaign, maxUTMLen},
+		{"ios_url", rec.IOSURL, maxLongURLLen},
+		{"android_url", rec.AndroidURL, maxLongURLLen},
+	} {
+		if utf8.RuneCountInString(f.value) > f.max {
+			return rec, nil, fmt.Errorf("%s is longer than %d characters", f.name, f.max)
+		}
+		if f.name != "long_url" && f.value != "" {
+			applied = append(applied, f.name)
+		}
+	}
+	if err := checkAppURL("ios_url", &rec.IOSURL); err != nil {
+		return rec, nil, err
+	}
+	if err := checkAppURL("android_url", &rec.AndroidURL); err != nil {
+		return rec, nil, err
+	}
+	if err := checkAppLink(rec.RedirectType, rec.IOSURL, rec.AndroidURL); err != nil {
+		return rec, nil, err
+	}
+	if err := checkPasswordHint(&rec.PasswordHint); err != nil {
+		return rec, nil, err
+	} else if rec.PasswordHint != "" {
+		applied = append(applied, "password_hint")
+	}
+	if err := checkExpireAfterIdle(&rec.ExpireAfterIdle); err != nil {
+		return rec, nil, err
+	} else if rec.ExpireAfterIdle != "" {
+		applied = append(applied, "expire_after_idle")
+	}
+	if rec.RedirectStatus = cmp.Or(in.RedirectStatus, defaultRedirectStatus); !validRedirectStatus(rec.RedirectStatus) {
+		return rec, nil, errors.New("redirect_status must be 301, 302, 307 or 308")
+	} else if rec.RedirectStatus != defaultRedirectStatus {
+		applied = append(applied, "redirect_status")
+	}
+	if rec.OGImage != "" {
+		if u, err := url.Parse(rec.OGImage); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return rec, nil, errors.New("og_image must be an http(s) URL")
+		}
+	}
+	if rec.ExpiresAt = strings.TrimSpace(in.ExpiresAt); rec.ExpiresAt != "" {
+		if _, err := time.Parse(time.RFC3339, rec.ExpiresAt); err != nil {
+			return rec, nil, errors.New("expires_at must be RFC3339 (e.g. 2026-03-01T00:00:00Z)")
+		}
+		applied = append(applied, "expires_at")
+	}
+	if in.MaxUses < 0 || in.UseCount < 0 {
+		return rec, nil, errors.New("max_uses and use_count must not be negative")
+	}
+	if rec.MaxUses = in.MaxUses; rec.MaxUses > 0 {
+		applied = append(applied, "max_uses")
+	}
+	if in.CacheTTL != nil {
+		if *in.CacheTTL < -1 {
+			return rec, nil, errors.New("cache_ttl must be seconds (0 = no-store, -1 = default)")
+		}
+		if rec.CacheTTL = *in.CacheTTL; rec.CacheTTL != -1 {
+			applied = append(applied, "cache_ttl")
+		}
+	}
+	if rec.NoAnalytics = in.NoAnalytics; rec.NoAnalytics {
+		applied = append(applied, "no_analytics")
+	}
+	if rec.PathForward = in.PathForward; rec.PathForward {
+		applied = append(applied, "path_forward")
+	}
+	if rec.ForwardQuery = in.ForwardQuery; rec.ForwardQuery {
+		applied = append(applied, "forward_query")
+	}
+	if err := checkParamSpec(rec.LongURL, &in.ParamSpec); err != nil {
+		return rec, nil, err
+	} else if rec.ParamSpec = in.ParamSpec; !rec.ParamSpec.isZero() {
+		applied = append(applied, "param_spec")
+	}
+	tags, err := linkTags(in.Tags)
+	if err != nil {
+		return rec, nil, err
+	}
+	if rec.Tags = tags; len(tags) > 0 {
+		applied = append(applied, "tags")
+	}
+	if in.CreatedAt != "" {
+		if _, err := parseStoredTime(in.CreatedAt); err != nil {
+			return rec, nil, errors.New("created_at must be an RFC3339 time (or 2006-01-02 15:04:05 UTC)")
+		}
+	}
+	return rec, applied, nil
+}
+
+// parseImportCSV reads a CSV upload with a header row into importRows.
+func parseImportCSV(r io.Reader) ([]importRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := col["long_url"]; !ok {
+		if i, ok := col["url"]; ok {
+			col["long_url"] = i
+		} else {
+			return nil, errors.New("header must include a long_url (or url) column")
+		}
+	}
+
+	var rows []importRow
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		get := func(name string) string {
+			if i, ok := col[name]; ok && i < len(fields) {
+				return fields[i]
+			}
+			return ""
+		}
+		flag := func(name string) (*bool, error) {
+			var b bool
+			switch v := strings.ToLower(strings.TrimSpace(get(name))); v {
+			case "":
+				return nil, nil
+			case "yes", "y":
+				b = true
+			case "no", "n":
+				b = false
+			default:
+				var err error
+				if b, err = strconv.ParseBool(v); err != nil {
+					return nil, fmt.Errorf("%s must be true or false", name)
+				}
+			}
+			return &b, nil
+		}
+		row := importRow{
+			Code:            get("code"),
+			LongURL:         get("long_url"),
+			RedirectType:    get("redirect_type"),
+			OGTitle:         get("og_title"),
+			OGDescription:   get("og_description"),
+			OGImage:         get("og_image"),
+			Description:     get("description"),
+			UTMSource:       get("utm_source"),
+			UTMMedium:       get("utm_medium"),
+			UTMCampaign:     get("utm_campaign"),
+			IOSURL:          get("ios_url"),
+			AndroidURL:      get("android_url"),
+			PasswordHint:    get("password_hint"),
+			ExpireAfterIdle: get("expire_after_idle"),
+			ExpiresAt:       get("expires_at"),
+			CreatedAt:       strings.TrimSpace(get("created_at")),
+		}
+		num := func(name string) (*int, error) {
+			v := strings.TrimSpace(get(name))
+			if v == "" {
+				return nil, nil
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a whole number", name)
+			}
+			return &n, nil
+		}
+		if tags := strings.TrimSpace(get("tags")); tags != "" {
+			row.Tags = strings.Split(tags, ",")
+		}
+		if err := row.ParamSpec.Scan(strings.TrimSpace(get("param_spec"))); err != nil {
+			row.err = errors.New("param_spec must be a JSON object")
+		}
+		var maxUses, useCount, redirectStatus *int
+		var noAnalytics, pathForward, forwardQuery *bool
+		if row.PublicEnabled, err = flag("public_enabled"); err != nil {
+			row.err = err
+		} else if row.InternalEnabled, err = flag("internal_enabled"); err != nil {
+			row.err = err
+		} else if noAnalytics, err = flag("no_analytics"); err != nil {
+			row.err = err
+		} else if pathForward, err = flag("path_forward"); err != nil {
+			row.err = err
+		} else if forwardQuery, err = flag("forward_query"); err != nil {
+			row.err = err
+		} else if maxUses, err = num("max_uses"); err != nil {
+			row.err = err
+		} else if useCount, err = num("use_count"); err != nil {
+			row.err = err
+		} else if row.CacheTTL, err = num("cache_ttl"); err != nil {
+			row.err = err
+		} else if redirectStatus, err = num("redirect_status"); err != nil {
+			row.err = err
+		}
+		row.NoAnalytics = noAnalytics != nil && *noAnalytics
+		row.PathForward = pathForward != nil && *pathForward
+		row.ForwardQuery = forwardQuery != nil && *forwardQuery
+		if maxUses != nil {
+			row.MaxUses = *maxUses
+		}
+		if useCount != nil {
+			row.UseCount = *useCount
+		}
+		if redirectStatus != nil {
+			row.RedirectStatus = *redirectStatus
+		}
+		rows = append(rows, row)
+	}
+}
+
+// importHandler serves POST /import. The body is a JSON array of importRow
+// objects, or CSV when ?format=csv or the Content-Type mentions csv; both
+// match GET /export. ?mode=skip (default) leaves existing codes alone,
+// ?mode=overwrite replaces their exported fields (the password and uploaded
+// image stay). Rows that fail validation are reported and left out; the rest
+// go in one transaction, so a database error imports nothing.
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	mode := cmp.Or(r.URL.Query().Get("mode"), "skip")
+	if mode != "skip" && mode != "overwrite" {
+		jsonError(w, http.StatusBadRequest, "mode must be skip or overwrite")
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Content-Type"), "csv") {
+		format = "csv"
+	}
+
+	var rows []importRow
+	var err error
+	switch format {
+	case "csv":
+		rows, err = parseImportCSV(body)
+	case "", "json":
+		err = json.NewDecoder(body).Decode(&rows)
+	default:
+		jsonError(w, http.StatusBadRequest, "format must be csv or json")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid "+cmp.Or(format, "json")+": "+err.Error())
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	defer tx.Rollback()
+
+	results := make([]importResult, 0, len(rows))
+	counts := map[string]int{"imported": 0, "skipped": 0, "failed": 0}
+	var imported []string
+	for i, in := range rows {
+		res := importResult{Row: i + 1, Code: strings.TrimSpace(in.Code)}
+		rec, applied, err := in.record()
+		switch {
+		case err != nil:
+			res.Status, res.Error = "failed", err.Error()
+		case res.Code != "" && !validCode.MatchString(res.Code):
+			res.Status, res.Error = "failed", "code must be 1–32 chars: letters, numbers, hyphens, underscores"
+		case blockedCode(res.Code):
+			res.Status, res.Error = "failed", "code is not allowed"
+		default:
+			res.Status, res.Applied = "imported", applied
+			action := auditCreate
+			if res.Code, err = insertURLSavepoint(tx, res.Code, rec); isUniqueViolation(err) {
+				if mode == "skip" {
+					res.Status, res.Applied = "skipped", nil
+					break
+				}
+				action = auditImport
+				err = overwriteURL(tx, res.Code, rec)
+			}
+			if err == nil {
+				err = restoreImportCounters(tx, res.Code, in, mode == "overwrite")
+			}
+			if err == nil {
+				err = logAudit(tx, res.Code, action, "", rec.LongURL, clientIP(r))
+			}
+			if err != nil {
+				log.Printf("import row %d: %v", res.Row, err)
+				jsonError(w, http.StatusInternalServerError, fmt.Sprintf("database error at row %d; nothing was imported", res.Row))
+				return
+			}
+		}
+		if res.Status == "imported" {
+			imported = append(imported, res.Code)
+		}
+		counts[res.Status]++
+		results = append(results, res)
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error; nothing was imported")
+		return
+	}
+	if len(imported) > 0 {
+		markChanged()
+		forgetRecord(imported...)
+	}
+
+	writeJSON(w, r, http.StatusOK, map[string]any{
+		"imported": counts["imported"],
+		"skipped":  counts["skipped"],
+		"failed":   counts["failed"],
+		"results":  results,
+	})
+}
+
+// overwriteURL replaces the exported fields of an existing link with rec,
+// taking it out of the trash if it was there.
+func overwriteURL(tx *sqlTx, code string, rec urlRecord) error {
+	if _, err := tx.Exec("UPDATE urls SET deleted_at = '' WHERE code = ?", code); err != nil {
+		return err
+	}
+	return updateURL(tx, code, urlPatch{
+		LongURL:         &rec.LongURL,
+		PublicEnabled:   &rec.PublicEnabled,
+		InternalEnabled: &rec.InternalEnabled,
+		RedirectType:    &rec.RedirectType,
+		RedirectStatus:  &rec.RedirectStatus,
+		OGTitle:         &rec.OGTitle,
+		OGDescription:   &rec.OGDescription,
+		OGImage:         &rec.OGImage,
+		Description:     &rec.Description,
+		ExpiresAt:       &rec.ExpiresAt,
+		MaxUses:         &rec.MaxUses,
+		CacheTTL:        &rec.CacheTTL,
+		NoAnalytics:     &rec.NoAnalytics,
+		Tags:            &rec.Tags,
+		UTMSource:       &rec.UTMSource,
+		UTMMedium:       &rec.UTMMedium,
+		UTMCampaign:     &rec.UTMCampaign,
+		IOSURL:          &rec.IOSURL,
+		AndroidURL:      &rec.AndroidURL,
+		PasswordHint:    &rec.PasswordHint,
+		PathForward:     &rec.PathForward,
+		ExpireAfterIdle: &rec.ExpireAfterIdle,
+		ForwardQuery:    &rec.ForwardQuery,
+		ParamSpec:       &rec.ParamSpec,
+	})
+}
+
+// restoreImportCounters carries over use_count and created_at, which new
+// rows would otherwise start from scratch. use_count is always written on
+// overwrite, so the file's count replaces the old one. created_at from older
+// exports is converted to RFC3339.
+func restoreImportCounters(tx *sqlTx, code string, in importRow, overwrite bool) error {
+	if in.UseCount == 0 && in.CreatedAt == "" && !overwrite {
+		return nil
+	}
+	_, err := tx.Exec(
+		"UPDATE urls SET use_count = ?, created_at = CASE WHEN ? = '' THEN created_at ELSE ? END WHERE code = ?",
+		in.UseCount, in.CreatedAt, storedTime(in.CreatedAt), code,
+	)
+	return err
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// A template link has templatePlaceholder in its long_url. On the internal
+// host its code also works as a prefix: with a template link "jira-" to
+// https://jira.example.com/browse/{*}, go/jira-123 redirects to
+// https://jira.example.com/browse/123. The longest matching prefix wins, and
+// a link whose code is the whole name always beats a template.
+const templatePlaceholder = "{*}"
+
+func isTemplateURL(longURL string) bool {
+	return strings.Contains(longURL, templatePlaceholder)
+}
+
+// checkTemplateURL rejects placeholders that could change a template link's
+// scheme or host; they may only appear after the host.
+func checkTemplateURL(longURL string) error {
+	i := strings.Index(longURL, templatePlaceholder)
+	if i < 0 {
+		return nil
+	}
+	u, err := url.Parse(strings.ReplaceAll(longURL, templatePlaceholder, "x"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("a long_url with {*} must be an absolute http(s) URL")
+	}
+	if i <= len(u.Scheme+"://"+u.Host) {
+		return errors.New("{*} may only appear in the path, query or fragment of long_url")
+	}
+	return nil
+}
+
+// fillTemplate substitutes arg, escaped so it cannot add path segments or
+// query parameters, for every placeholder in longURL.
+func fillTemplate(longURL, arg string) string {
+	return strings.ReplaceAll(longURL, templatePlaceholder, strings.ReplaceAll(url.QueryEscape(arg), "+", "%20"))
+}
+
+// maxSpecParams caps the names in each list of a paramSpec; maxParamNameLen
+// caps each name.
+const (
+	maxSpecParams   = 20
+	maxParamNameLen = 64
+)
+
+// paramSpec optionally declares the query parameters a template link takes,
+// stored as JSON in urls.param_spec (empty when unset). Required parameters
+// must be present and non-empty; when Allowed is set, the request may carry no
+// other parameters than Required and Allowed. It only applies while long_url
+// has a placeholder.
+type paramSpec struct {
+	Required []string `json:"required,omitempty"`
+	Allowed  []string `json:"allowed,omitempty"`
+}
+
+func (s paramSpec) isZero() bool {
+	return len(s.Required) == 0 && len(s.Allowed) == 0
+}
+
+func (s *paramSpec) Scan(src any) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("param_spec: unsupported type %T", src)
+	}
+	*s = paramSpec{}
+	if len(b) == 0 {
+		return nil
+	}
+	return json.Unmarshal(b, s)
+}
+
+func (s paramSpec) Value() (driver.Value, error) {
+	if s.isZero() {
+		return "", nil
+	}
+	b, err := json.Marshal(s)
+	return string(b), err
+}
+
+// checkParamSpec trims and deduplicates the names in s and rejects empty or
+// overlong names, oversized lists and a spec on a long_url without {*}.
+func checkParamSpec(longURL string, s *paramSpec) error {
+	if s == nil {
+		return nil
+	}
+	for _, list := range []*[]string{&s.Required, &s.Allowed} {
+		if len(*list) > maxSpecParams {
+			return fmt.Errorf("param_spec lists at most %d parameters each", maxSpecParams)
+		}
+		var names []string
+		for _, name := range *list {
+			name = strings.TrimSpace(name)
+			if name == "" || len(name) > maxParamNameLen {
+				return fmt.Errorf("param_spec names must be 1–%d characters", maxParamNameLen)
+			}
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		*list = names
+	}
+	if !s.isZero() && !isTemplateURL(longURL) {
+		return errors.New("param_spec needs a long_url with {*}")
+	}
+	return nil
+}
+
+// check reports the first way query breaks the spec, or nil.
+func (s paramSpec) check(query url.Values) error {
+	for _, name := range s.Required {
+		if query.Get(name) == "" {
+			return fmt.Errorf("missing query parameter %q", name)
+		}
+	}
+	if len(s.Allowed) == 0 {
+		return nil
+	}
+	for _, name := range slices.Sorted(maps.Keys(query)) {
+		if !slices.Contains(s.Required, name) && !slices.Contains(s.Allowed, name) {
+			return fmt.Errorf("query parameter %q is not allowed", name)
+		}
+	}
+	return nil
+}
+
+// findTemplateLink returns the template link with the longest code that is
+// a proper prefix of name, or sql.ErrNoRows.
+func findTemplateLink(name string) (string, urlRecord, error) {
+	var rec urlRecord
+	prefixes := make([]any, 0, len(name))
+	for n := len(name) - 1; n > 0; n-- {
+		prefixes = append(prefixes, name[:n])
+	}
+	if len(prefixes) == 0 {
+		return "", rec, sql.ErrNoRows
+	}
+	var code string
+	err := db.QueryRow(
+		"SELECT code, "+recordColumns+" FROM urls WHERE code IN (?"+strings.Repeat(", ?", len(prefixes)-1)+") AND long_url LIKE '%{*}%' AND "+liveLink+" ORDER BY length(code) DESC LIMIT 1",
+		prefixes...,
+	).Scan(append([]any{&code}, rec.scanTargets()...)...)
+	return code, rec, err
+}
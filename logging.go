@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// jsonAccessLog writes the LOG_FORMAT=json access lines.
+var jsonAccessLog = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+// statusWriter records the status code and body size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// accessLog wraps next with one log line per request in LOG_FORMAT: "text"
+// (default), "json", or "off".
+func accessLog(next http.Handler) http.Handler {
+	if logFormat == "off" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		took := time.Since(start)
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK // handler wrote nothing
+		}
+		route := routeOf(r)
+		if route == "" {
+			route = "unknown"
+		}
+		if logFormat == "json" {
+			jsonAccessLog.Info("request",
+				"method", r.Method,
+				"host", effectiveHost(r),
+				"path", r.URL.Path,
+				"status", status,
+				"size", sw.size,
+				"duration_ms", float64(took.Microseconds())/1000,
+				"route", route,
+			)
+			return
+		}
+		log.Printf("%s %s%s %d %dB %s [%s]", r.Method, effectiveHost(r), r.URL.Path, status, sw.size, took.Round(time.Microsecond), route)
+	})
+}
@@ -1,31 +1,75 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os/signal"
+	"syscall"
 
 	_ "modernc.org/sqlite"
 )
 
-const (
-	charset = "abcdefghkprstxyz2345678"
-	codeLen = 6
-)
-
 func main() {
+	if logFormat != "text" && logFormat != "json" && logFormat != "off" {
+		log.Fatalf("LOG_FORMAT must be text, json or off, got %q", logFormat)
+	}
+	if err := checkCodeConfig(); err != nil {
+		log.Fatal(err)
+	}
 	if err := initDB(); err != nil {
 		log.Fatalf("failed to init database: %v", err)
 	}
-	defer db.Close()
 
+	// Before seeding: seeded links are typed by default_redirect_type.
 	if err := loadSettings(); err != nil {
 		log.Fatalf("failed to load settings: %v", err)
 	}
 
+	if seedFile != "" {
+		if err := seedFromFile(seedFile); err != nil {
+			log.Fatalf("failed to seed links: %v", err)
+		}
+	}
+	if err := loadSessionKey(); err != nil {
+		log.Fatalf("failed to load session key: %v", err)
+	}
+
 	pb, ph, uh, ih, ah := cfg.snapshot()
 	papiHost := cfg.publicAPIHostVal()
 	log.Printf("public: %s (%s)  ui: %s  internal: %s  alias: %s  public-api: %s", pb, ph, uh, ih, ah, papiHost)
 
-	http.HandleFunc("/", mainHandler)
-	log.Fatal(http.ListenAndServe(port, nil))
+	startExpiryNotifier()
+	startCleanup()
+	startClickHook()
+
+	srv := &http.Server{Addr: port, Handler: accessLog(http.HandlerFunc(mainHandler))}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	stop() // a second signal kills the process the usual way
+
+	// Drain in-flight requests, then close the database so SQLite can
+	// checkpoint its WAL cleanly.
+	log.Printf("shutting down: draining requests (up to %s)", shutdownTimeout)
+	sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("server: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Printf("close database: %v", err)
+	}
+	log.Println("shutdown complete")
 }
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMain runs the tests against a fresh SQLite database in a temporary
+// directory, with the settings at their env defaults.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "gourl-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	dbFile = filepath.Join(dir, "test.db")
+	ogImageDir = filepath.Join(dir, "og-images")
+	log.SetOutput(io.Discard)
+	if err := initDB(); err != nil {
+		log.Fatalf("init database: %v", err)
+	}
+	if err := loadSettings(); err != nil {
+		log.Fatalf("load settings: %v", err)
+	}
+	code := m.Run()
+	db.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus metrics, served at GET /metrics on the UI and internal hosts
+// (behind requireAdmin, so scrapers use HTTP Basic auth when ADMIN_PASSWORD
+// is set).
+var (
+	redirectsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gourl_redirects_total",
+		Help: "Short link lookups by host type (public, alias, internal) and result (hit, password_required, not_found, disabled, expired, exhausted, bad_params, error).",
+	}, []string{"host", "result"})
+	redirectDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gourl_redirect_duration_seconds",
+		Help:    "Time to answer a short link lookup.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14), // 0.5ms … ~4s
+	}, []string{"host"})
+	shortenTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gourl_shorten_requests_total",
+		Help: "POST /shorten requests by result (created, reused, rejected, conflict, error).",
+	}, []string{"result"})
+	passAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gourl_password_attempts_total",
+		Help: "Link password attempts on /pass/ by result (success, fail, rate_limited).",
+	}, []string{"result"})
+	clickHookTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gourl_click_webhook_total",
+		Help: "Click webhook deliveries by result (sent, failed, dropped).",
+	}, []string{"result"})
+)
+
+// metricsHandler serves GET /metrics in the Prometheus text format.
+var metricsHandler = promhttp.Handler().ServeHTTP
+
+// redirectHostType names the host a lookup came in on for metric labels.
+func redirectHostType(r *http.Request, internal bool) string {
+	if internal {
+		return "internal"
+	}
+	if routeOf(r) == routeAlias {
+		return "alias"
+	}
+	return "public"
+}
+
+// observeRedirect records one doRedirect call. outcome is a clicks outcome,
+// or empty when the lookup failed with an internal error.
+func observeRedirect(host, outcome string, took time.Duration) {
+	result := outcome
+	switch outcome {
+	case outcomeRedirected:
+		result = "hit"
+	case "":
+		result = "error"
+	}
+	redirectsTotal.WithLabelValues(host, result).Inc()
+	redirectDuration.WithLabelValues(host).Observe(took.Seconds())
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"cmp"
+	_ "embed"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+//go:embed static/404.html
+var notFoundTmplSrc string
+
+var notFoundTmpl = template.Must(template.New("404").Parse(notFoundTmplSrc))
+
+// linkUnavailable answers a redirect that has no usable link behind it: an
+// unknown code, or a disabled, expired or used-up link. With the
+// not_found_redirect setting (internal_not_found_redirect on the internal
+// host) set, the visitor is sent there; otherwise browsers get the 404.html
+// page and other clients the plain-text msg, both with status.
+func linkUnavailable(w http.ResponseWriter, r *http.Request, internal bool, status int, msg string) {
+	key := "not_found_redirect"
+	if internal {
+		key = "internal_not_found_redirect"
+	}
+	if target := cfg.setting(key); target != "" {
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, target, http.StatusFound)
+		return
+	}
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Error(w, msg, status)
+		return
+	}
+	heading := "Link not found"
+	if status == http.StatusGone {
+		heading = "Link no longer available"
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	notFoundTmpl.Execute(w, struct {
+		Status     int
+		Heading    string
+		Message    string
+		SiteTitle  string
+		FaviconURL string
+	}{status, heading, strings.ToUpper(msg[:1]) + msg[1:] + ".", cmp.Or(cfg.setting("site_title"), defaultSiteTitle), cfg.setting("favicon_url")})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const expiryNotifyInterval = time.Minute
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// startExpiryNotifier launches the background job that announces links
+// entering the EXPIRY_NOTIFY_WINDOW. It does nothing when the window is 0.
+func startExpiryNotifier() {
+	if expiryNotifyWindow <= 0 {
+		return
+	}
+	go func() {
+		for {
+			notifyExpiring()
+			time.Sleep(expiryNotifyInterval)
+		}
+	}()
+}
+
+// notifyExpiring sends one heads-up per link per expires_at. The row is
+// marked before sending, so a failed webhook is logged and not retried.
+func notifyExpiring() {
+	urls, err := getExpiringURLs(expiryNotifyWindow)
+	if err != nil {
+		log.Printf("expiry notifier: %v", err)
+		return
+	}
+	for _, u := range urls {
+		res, err := db.Exec("UPDATE urls SET expiry_notified = 1 WHERE code = ? AND expiry_notified = 0", u.Code)
+		if err != nil {
+			log.Printf("expiry notifier: %s: %v", u.Code, err)
+			continue
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue // already announced
+		}
+		log.Printf("expiry notifier: %s expires at %s", u.Code, u.ExpiresAt)
+		if expiryWebhookURL != "" {
+			if err := postWebhook(expiryWebhookURL, map[string]any{
+				"event": "link.expiring",
+				"link":  linkJSON(u),
+			}); err != nil {
+				log.Printf("expiry notifier: %s: webhook: %v", u.Code, err)
+			}
+		}
+	}
+}
+
+// postWebhook POSTs payload as JSON and treats any non-2xx reply as an error.
+func postWebhook(url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
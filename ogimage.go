@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Uploaded OpenGraph images live as files in ogImageDir, named by a random
+// id so renames never have to touch the disk; urls.og_image_file holds the
+// name. When set, it takes precedence over the og_image URL.
+const maxOGImageBytes = 2 << 20
+
+// ogImageTypes maps the accepted (sniffed) content types to file extensions.
+var ogImageTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+type ogUpload struct {
+	data []byte
+	ext  string
+}
+
+// decodeLinkBody decodes a create/patch request into v. JSON bodies are
+// decoded directly. multipart/form-data bodies carry the same JSON in a
+// "payload" field, or the fields one by one as form fields (decodeForm), and
+// may add an image file in "og_image_file". application/x-www-form-urlencoded
+// bodies are form fields only, unless they hold a JSON object: that is what
+// curl -d '{...}' sends without a Content-Type, so it stays JSON.
+func decodeLinkBody(w http.ResponseWriter, r *http.Request, v any) (*ogUpload, error) {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mt {
+	case "multipart/form-data":
+	case "application/x-www-form-urlencoded":
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxFormBytes))
+		if err != nil {
+			return nil, errors.New("invalid form body")
+		}
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+			if err := json.Unmarshal(trimmed, v); err != nil {
+				return nil, errors.New("invalid JSON")
+			}
+			return nil, nil
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, errors.New("invalid form body")
+		}
+		return nil, decodeForm(form, v)
+	default:
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			return nil, errors.New("invalid JSON")
+		}
+		return nil, nil
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxOGImageBytes+64<<10)
+	if err := r.ParseMultipartForm(maxOGImageBytes); err != nil {
+		return nil, errors.New("invalid multipart body (images are limited to 2 MB)")
+	}
+	if _, ok := r.MultipartForm.Value["payload"]; !ok {
+		if err := decodeForm(r.MultipartForm.Value, v); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal([]byte(r.FormValue("payload")), v); err != nil {
+		return nil, errors.New("invalid JSON in payload field")
+	}
+	f, _, err := r.FormFile("og_image_file")
+	if errors.Is(err, http.ErrMissingFile) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.New("invalid og_image_file")
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxOGImageBytes+1))
+	if err != nil {
+		return nil, errors.New("invalid og_image_file")
+	}
+	if len(data) > maxOGImageBytes {
+		return nil, fmt.Errorf("og_image_file must be at most %d bytes", maxOGImageBytes)
+	}
+	// Trust the bytes, not the client's Content-Type.
+	ext, ok := ogImageTypes[http.DetectContentType(data)]
+	if !ok {
+		return nil, errors.New("og_image_file must be a PNG, JPEG, GIF or WebP image")
+	}
+	return &ogUpload{data: data, ext: ext}, nil
+}
+
+// setOGImage stores up as code's uploaded image, or removes it when up is
+// nil. The previous file, if any, is deleted.
+func setOGImage(code string, up *ogUpload) error {
+	rec, err := getRecord(code)
+	if err != nil {
+		return err
+	}
+	name := ""
+	if up != nil {
+		id := make([]byte, 16)
+		rand.Read(id)
+		name = hex.EncodeToString(id) + up.ext
+		if err := os.MkdirAll(ogImageDir, 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(ogImageDir, name), up.data, 0o644); err != nil {
+			return err
+		}
+	}
+	if err := updateURL(db, code, urlPatch{OGImageFile: &name}); err != nil {
+		removeOGImageFile(name)
+		return err
+	}
+	removeOGImageFile(rec.OGImageFile)
+	return nil
+}
+
+func removeOGImageFile(name string) {
+	if name == "" {
+		return
+	}
+	if err := os.Remove(filepath.Join(ogImageDir, filepath.Base(name))); err != nil && !os.IsNotExist(err) {
+		log.Printf("remove og image %s: %v", name, err)
+	}
+}
+
+// removeAllOGImageFiles empties ogImageDir, for POST /admin/reset.
+func removeAllOGImageFiles() {
+	entries, err := os.ReadDir(ogImageDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("remove og images: %v", err)
+		}
+		return
+	}
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			removeOGImageFile(e.Name())
+		}
+	}
+}
+
+// ogImageURL is the absolute URL of code's uploaded image under base.
+func ogImageURL(base, code string) string {
+	return strings.TrimRight(base, "/") + "/ogimg/" + code
+}
+
+// ogImageHandler serves GET /ogimg/{code}, the uploaded image of a link.
+func ogImageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	code := strings.TrimPrefix(r.URL.Path, "/ogimg/")
+	rec, err := getRecord(code)
+	if err == sql.ErrNoRows || (err == nil && rec.OGImageFile == "") {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	f, err := os.Open(filepath.Join(ogImageDir, filepath.Base(rec.OGImageFile)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	for ct, ext := range ogImageTypes {
+		if ext == filepath.Ext(rec.OGImageFile) {
+			w.Header().Set("Content-Type", ct)
+		}
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	http.ServeContent(w, r, "", fi.ModTime(), f)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GET /og-image/{code} proxies a link's og_image URL, so social scrapers
+// fetch the card image from us instead of a slow or hotlink-protected
+// origin. Fetched images are kept in a per-process LRU bounded by
+// ogProxyCacheBytes; failures are remembered for ogProxyRetryAfter so a
+// dead origin is not hit on every scrape.
+const (
+	ogProxyCacheBytes = 64 << 20
+	ogProxyTTL        = time.Hour
+	ogProxyRetryAfter = 5 * time.Minute
+)
+
+type ogProxyEntry struct {
+	code    string
+	src     string // og_image the bytes came from; an edit invalidates the entry
+	data    []byte // nil when the fetch failed
+	ctype   string
+	fetched time.Time
+}
+
+// ogProxyLRU maps link codes to fetched images, least recently used at the
+// back of order.
+type ogProxyLRU struct {
+	mu      sync.Mutex
+	max     int
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+var ogProxyCache = &ogProxyLRU{max: ogProxyCacheBytes, order: list.New(), entries: map[string]*list.Element{}}
+
+// get returns code's entry if it was fetched from src and is still fresh.
+func (c *ogProxyLRU) get(code, src string) (*ogProxyEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[code]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*ogProxyEntry)
+	ttl := ogProxyTTL
+	if e.data == nil {
+		ttl = ogProxyRetryAfter
+	}
+	if e.src != src || time.Since(e.fetched) >= ttl {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return e, true
+}
+
+// put stores e, evicting the least recently used entries to stay in budget.
+func (c *ogProxyLRU) put(e *ogProxyEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[e.code]; ok {
+		c.remove(el)
+	}
+	c.entries[e.code] = c.order.PushFront(e)
+	c.size += len(e.data)
+	for c.size > c.max && c.order.Len() > 1 {
+		c.remove(c.order.Back())
+	}
+}
+
+// clear drops every entry, for POST /admin/reset.
+func (c *ogProxyLRU) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.entries)
+	c.size = 0
+}
+
+func (c *ogProxyLRU) remove(el *list.Element) {
+	e := c.order.Remove(el).(*ogProxyEntry)
+	delete(c.entries, e.code)
+	c.size -= len(e.data)
+}
+
+// ogProxyURL is the absolute URL of code's proxied og:image under base.
+func ogProxyURL(base, code string) string {
+	return strings.TrimRight(base, "/") + "/og-image/" + code
+}
+
+// fetchOGImage GETs src and returns the image bytes and sniffed type. Only
+// the upload types are accepted, and at most maxOGImageBytes are read.
+func fetchOGImage(ctx context.Context, src string) ([]byte, string, error) {
+	if u, err := url.Parse(src); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, "", errors.New("not an http(s) URL")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", "gourl-fetcher")
+	req.Header.Set("Accept", "image/*")
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxOGImageBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxOGImageBytes {
+		return nil, "", fmt.Errorf("larger than %d bytes", maxOGImageBytes)
+	}
+	ct := http.DetectContentType(data)
+	if _, ok := ogImageTypes[ct]; !ok {
+		return nil, "", fmt.Errorf("not a PNG, JPEG, GIF or WebP image (%s)", ct)
+	}
+	return data, ct, nil
+}
+
+// ogProxyHandler serves GET /og-image/{code}: the link's og_image fetched
+// server-side, or a redirect to the original URL when it cannot be fetched.
+// Links not enabled on the public hosts are only proxied on the UI and
+// internal hosts.
+func ogProxyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	code := strings.TrimPrefix(r.URL.Path, "/og-image/")
+	rec, err := getRecord(code)
+	private := err == nil && !rec.PublicEnabled && routeOf(r) != routeInternal && routeOf(r) != routeUI
+	if err == sql.ErrNoRows || (err == nil && rec.OGImage == "") || private {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	e, ok := ogProxyCache.get(code, rec.OGImage)
+	if !ok {
+		// A scraper hanging up must not be remembered as a failed fetch.
+		data, ct, err := fetchOGImage(context.WithoutCancel(r.Context()), rec.OGImage)
+		if err != nil {
+			log.Printf("og image proxy %s: %v", code, err)
+		}
+		e = &ogProxyEntry{code: code, src: rec.OGImage, data: data, ctype: ct, fetched: time.Now()}
+		ogProxyCache.put(e)
+	}
+	if e.data == nil {
+		http.Redirect(w, r, rec.OGImage, http.StatusFound)
+		return
+	}
+	w.Header().Set("Content-Type", e.ctype)
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	http.ServeContent(w, r, "", e.fetched, bytes.NewReader(e.data))
+}
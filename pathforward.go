@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Links with path_forward also answer for paths below their code:
+// go/docs/api/v2 redirects to long_url with /api/v2 appended, and the
+// request's query string added to long_url's. Codes cannot contain "/", so
+// the first path segment is the longest prefix that can name a link.
+
+// forwardPath appends the path rest and the raw query query to longURL,
+// keeping longURL's own query and fragment. Empty segments are dropped so
+// the join never doubles a slash; "." and ".." are refused (ok is false) so
+// a forwarded path cannot climb out of long_url's path.
+func forwardPath(longURL, rest, query string) (string, bool) {
+	base, fragment, hasFragment := strings.Cut(longURL, "#")
+	base, baseQuery, _ := strings.Cut(base, "?")
+
+	var segments []string
+	for _, s := range strings.Split(rest, "/") {
+		switch s {
+		case "":
+			continue
+		case ".", "..":
+			return "", false
+		}
+		segments = append(segments, url.PathEscape(s))
+	}
+	if len(segments) > 0 {
+		base = strings.TrimRight(base, "/") + "/" + strings.Join(segments, "/")
+	}
+
+	if query != "" {
+		if baseQuery != "" {
+			baseQuery += "&"
+		}
+		baseQuery += query
+	}
+	if baseQuery != "" {
+		base += "?" + baseQuery
+	}
+	if hasFragment {
+		base += "#" + fragment
+	}
+	return base, true
+}
+
+// mergeQuery merges the raw query incoming into longURL's for forward_query
+// links. Parameters only one side has are all kept, longURL's first; for a
+// key both have, incoming's values replace longURL's, or are dropped when
+// preferDest. Pairs are copied as written, so their encoding and longURL's
+// fragment are left alone.
+func mergeQuery(longURL, incoming string, preferDest bool) string {
+	if incoming == "" {
+		return longURL
+	}
+	base, fragment, hasFragment := strings.Cut(longURL, "#")
+	base, baseQuery, _ := strings.Cut(base, "?")
+	destPairs, inPairs := queryPairs(baseQuery), queryPairs(incoming)
+	destKeys, inKeys := queryKeys(destPairs), queryKeys(inPairs)
+
+	var pairs []string
+	for _, p := range destPairs {
+		if preferDest || !inKeys[queryKey(p)] {
+			pairs = append(pairs, p)
+		}
+	}
+	for _, p := range inPairs {
+		if !preferDest || !destKeys[queryKey(p)] {
+			pairs = append(pairs, p)
+		}
+	}
+	if len(pairs) > 0 {
+		base += "?" + strings.Join(pairs, "&")
+	}
+	if hasFragment {
+		base += "#" + fragment
+	}
+	return base
+}
+
+// queryPairs splits a raw query into its non-empty key=value pairs.
+func queryPairs(query string) []string {
+	var pairs []string
+	for _, p := range strings.Split(query, "&") {
+		if p != "" {
+			pairs = append(pairs, p)
+		}
+	}
+	return pairs
+}
+
+// queryKey is the decoded key of a raw key=value pair, so a=1 and %61=2
+// name the same parameter.
+func queryKey(pair string) string {
+	k, _, _ := strings.Cut(pair, "=")
+	if u, err := url.QueryUnescape(k); err == nil {
+		return u
+	}
+	return k
+}
+
+func queryKeys(pairs []string) map[string]bool {
+	keys := make(map[string]bool, len(pairs))
+	for _, p := range pairs {
+		keys[queryKey(p)] = true
+	}
+	return keys
+}
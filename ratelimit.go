@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiterMaxKeys caps the windows one rateLimiter keeps; past it a new
+// key evicts an arbitrary one.
+const rateLimiterMaxKeys = 10000
+
+// rateLimiter is a fixed-window counter per key, kept in memory. It is
+// per-process, like dataVersion: several instances each enforce their own
+// limit. A limit <= 0 allows everything.
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	hits   map[string]*rateWindow
+	swept  time.Time // last sweep; expired windows are dropped once per window
+}
+
+type rateWindow struct {
+	start time.Time
+	n     int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, hits: map[string]*rateWindow{}}
+}
+
+// allow counts a hit for key and reports whether it is within the limit; when
+// it is not, retryAfter is the time left until the window resets.
+func (l *rateLimiter) allow(key string) (ok bool, retryAfter time.Duration) {
+	if blocked, retry := l.exceeded(key); blocked {
+		return false, retry
+	}
+	l.hit(key)
+	return true, 0
+}
+
+// exceeded reports whether key has used up its window, without counting a
+// hit; limiters that only count failures pair it with hit.
+func (l *rateLimiter) exceeded(key string) (bool, time.Duration) {
+	if l.limit <= 0 {
+		return false, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	hw := l.hits[key]
+	if hw == nil || now.Sub(hw.start) >= l.window || hw.n < l.limit {
+		return false, 0
+	}
+	return true, hw.start.Add(l.window).Sub(now)
+}
+
+// hit counts one hit for key.
+func (l *rateLimiter) hit(key string) {
+	if l.limit <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.swept) >= l.window {
+		l.sweep(now)
+		l.swept = now
+	}
+	hw := l.hits[key]
+	if hw == nil && len(l.hits) >= rateLimiterMaxKeys {
+		for k := range l.hits {
+			delete(l.hits, k)
+			break
+		}
+	}
+	if hw == nil || now.Sub(hw.start) >= l.window {
+		hw = &rateWindow{start: now}
+		l.hits[key] = hw
+	}
+	hw.n++
+}
+
+// limitRequest applies l to r's client IP. Over the limit it writes the 429
+// and returns false; the handler should then return.
+func (l *rateLimiter) limitRequest(w http.ResponseWriter, r *http.Request) bool {
+	ok, retry := l.allow(clientIP(r))
+	if !ok {
+		backoffResponse(w, http.StatusTooManyRequests, "rate_limited", "rate limit exceeded", retry)
+	}
+	return ok
+}
+
+// reset forgets key, e.g. after a successful attempt.
+func (l *rateLimiter) reset(key string) {
+	l.mu.Lock()
+	delete(l.hits, key)
+	l.mu.Unlock()
+}
+
+// sweep drops expired windows; hit calls it once per window.
+func (l *rateLimiter) sweep(now time.Time) {
+	for k, hw := range l.hits {
+		if now.Sub(hw.start) >= l.window {
+			delete(l.hits, k)
+		}
+	}
+}
+
+// clientIP is the address rate limits are keyed on: the connection's peer.
+// With TRUST_PROXY it is the last X-Forwarded-For entry instead, the one the
+// proxy appended; earlier entries come from the client and are ignored, as
+// is the whole header without TRUST_PROXY, so a caller cannot pick its key.
+func clientIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); trustProxy && xff != "" {
+		if i := strings.LastIndexByte(xff, ','); i >= 0 {
+			xff = xff[i+1:]
+		}
+		if ip := strings.TrimSpace(xff); ip != "" {
+			return ip
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
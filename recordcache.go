@@ -0,0 +1,101 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// The redirect path reads links through recordCache, an LRU of getRecord
+// results bounded by recordCacheSize entries and recordCacheTTL. Writes that
+// change what a redirect does call forgetRecord once they are committed, so a
+// concurrent reader cannot re-cache the old row after it is dropped. Links
+// with max_uses are never cached so the use limit is always checked against
+// the database.
+type recordCacheEntry struct {
+	code    string
+	rec     urlRecord
+	fetched time.Time
+}
+
+// recordLRU maps codes to records, least recently used at the back of order.
+type recordLRU struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+var recordCache = &recordLRU{max: recordCacheSize, order: list.New(), entries: map[string]*list.Element{}}
+
+// cachedRecord is getRecord served from recordCache when possible. Misses
+// are not cached, so a new link is visible on its first request.
+func cachedRecord(code string) (urlRecord, error) {
+	if rec, ok := recordCache.get(code); ok {
+		return rec, nil
+	}
+	rec, err := getRecord(code)
+	if err == nil && rec.MaxUses == 0 {
+		recordCache.put(code, rec)
+	}
+	return rec, err
+}
+
+// forgetRecord drops codes from recordCache after their rows changed.
+func forgetRecord(codes ...string) {
+	recordCache.mu.Lock()
+	defer recordCache.mu.Unlock()
+	for _, code := range codes {
+		if el, ok := recordCache.entries[code]; ok {
+			recordCache.remove(el)
+		}
+	}
+}
+
+// forgetAllRecords empties recordCache.
+func forgetAllRecords() {
+	recordCache.mu.Lock()
+	defer recordCache.mu.Unlock()
+	recordCache.order.Init()
+	clear(recordCache.entries)
+}
+
+func (c *recordLRU) get(code string) (urlRecord, bool) {
+	if c.max <= 0 {
+		return urlRecord{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[code]
+	if !ok {
+		return urlRecord{}, false
+	}
+	e := el.Value.(*recordCacheEntry)
+	if time.Since(e.fetched) >= recordCacheTTL {
+		c.remove(el)
+		return urlRecord{}, false
+	}
+	c.order.MoveToFront(el)
+	return e.rec, true
+}
+
+// put stores rec, evicting the least recently used entry when full.
+func (c *recordLRU) put(code string, rec urlRecord) {
+	if c.max <= 0 || recordCacheTTL <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[code]; ok {
+		c.remove(el)
+	}
+	c.entries[code] = c.order.PushFront(&recordCacheEntry{code: code, rec: rec, fetched: time.Now()})
+	for c.order.Len() > c.max {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *recordLRU) remove(el *list.Element) {
+	e := c.order.Remove(el).(*recordCacheEntry)
+	delete(c.entries, e.code)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// redirectPageData is what the meta, js and applink redirect pages render.
+// The meta_template and js_template settings replace the built-in meta and
+// js pages and see the same fields (and the jsStr function, which quotes a
+// string for a <script>):
+//
+//	.LongURL        destination, with UTM parameters applied; empty for
+//	                password links
+//	.ShortURL       the link on the public (or alias) host
+//	.Code           the short code
+//	.OGTitle, .OGDescription, .OGImage
+//	.HasPassword    js only: the page must POST {"password"} to .PassURL,
+//	                which answers {"url"} on success
+//	.PassURL, .PasswordHint
+type redirectPageData struct {
+	LongURL, ShortURL, OGTitle, OGDescription, OGImage, Code, PassURL string
+	IOSURL, AndroidURL, PasswordHint                                  string
+	HasPassword                                                       bool
+	FallbackMs                                                        int
+}
+
+// maxRedirectTemplateLen caps a meta_template or js_template setting.
+const maxRedirectTemplateLen = 64 << 10
+
+// sampleRedirectPage fills every field so a test render of a custom
+// template reaches both sides of the usual {{if}}s.
+var sampleRedirectPage = redirectPageData{
+	LongURL: "https://example.com/", ShortURL: "https://example.com/abc", Code: "abc",
+	OGTitle: "Title", OGDescription: "Description", OGImage: "https://example.com/a.png",
+	PassURL: "/pass/abc", PasswordHint: "Hint", HasPassword: true, FallbackMs: appLinkFallbackMs,
+}
+
+// parseRedirectTemplate parses a custom redirect page and renders it once
+// against sampleRedirectPage, so misspelt fields fail on save rather than on
+// a visitor's request.
+func parseRedirectTemplate(name, src string) (*template.Template, error) {
+	if len(src) > maxRedirectTemplateLen {
+		return nil, fmt.Errorf("is longer than %d bytes", maxRedirectTemplateLen)
+	}
+	t, err := template.New(name).Funcs(redirectTmplFuncs).Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Execute(io.Discard, sampleRedirectPage); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// customRedirectTmpls caches the parsed meta_template and js_template
+// settings so each is parsed once per change. A nil template means the
+// setting failed to parse and the built-in page is used.
+var customRedirectTmpls = struct {
+	sync.Mutex
+	src  map[string]string
+	tmpl map[string]*template.Template
+}{src: map[string]string{}, tmpl: map[string]*template.Template{}}
+
+// redirectTemplate returns the custom template in setting key, or builtin
+// when it is unset or invalid.
+func redirectTemplate(key string, builtin *template.Template) *template.Template {
+	src := cfg.setting(key)
+	if src == "" {
+		return builtin
+	}
+	c := &customRedirectTmpls
+	c.Lock()
+	defer c.Unlock()
+	if c.src[key] != src {
+		t, err := parseRedirectTemplate(key, src)
+		if err != nil {
+			log.Printf("%s: %v; using the built-in page", key, err)
+		}
+		c.src[key], c.tmpl[key] = src, t
+	}
+	if c.tmpl[key] == nil {
+		return builtin
+	}
+	return c.tmpl[key]
+}
+
+// renderRedirectPage writes the interstitial page for redirectType. A custom
+// page that fails to render falls back to the built-in one.
+func renderRedirectPage(w http.ResponseWriter, redirectType string, data redirectPageData) {
+	builtin, key := metaRedirectTmpl, "meta_template"
+	switch redirectType {
+	case "js":
+		builtin, key = jsRedirectTmpl, "js_template"
+	case "applink":
+		builtin, key = appLinkRedirectTmpl, ""
+	}
+	tmpl := builtin
+	if key != "" {
+		tmpl = redirectTemplate(key, builtin)
+	}
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, data)
+	if err != nil && tmpl != builtin {
+		log.Printf("%s: %v; using the built-in page", key, err)
+		buf.Reset()
+		err = builtin.Execute(&buf, data)
+	}
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
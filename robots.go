@@ -0,0 +1,28 @@
+package main
+
+import "net/http"
+
+// robotsTxt is served on the UI and internal hosts while the noindex
+// setting is on.
+const robotsTxt = "User-agent: *\nDisallow: /\n"
+
+// noindex keeps search engines out of the UI and internal hosts, which show
+// the whole link list: while the noindex setting is on, every response
+// carries X-Robots-Tag and /robots.txt disallows everything. The public
+// hosts are left crawlable; their interstitial pages carry their own robots
+// meta tag.
+func noindex(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.enabled("noindex") {
+			next(w, r)
+			return
+		}
+		w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+		if r.URL.Path == "/robots.txt" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(robotsTxt))
+			return
+		}
+		next(w, r)
+	}
+}
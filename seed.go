@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// seedLink is one entry of the SEED_FILE JSON array: an import row (the
+// GET /export JSON format) plus an optional plain-text password.
+type seedLink struct {
+	importRow
+	Password string `json:"password"`
+}
+
+// seedFromFile inserts the links listed in path whose codes don't exist yet.
+// Existing codes are left untouched, so running it on every start is safe.
+// Entries are validated like POST /import rows.
+func seedFromFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var links []seedLink
+	if err := json.Unmarshal(data, &links); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	var seeded, skipped, failed int
+	for i, l := range links {
+		code := strings.TrimSpace(l.Code)
+		if !validCode.MatchString(code) {
+			log.Printf("seed: entry %d: needs a valid code", i)
+			failed++
+			continue
+		}
+		if blockedCode(code) {
+			log.Printf("seed: %s: code is not allowed", code)
+			failed++
+			continue
+		}
+		rec, _, err := l.record()
+		if err != nil {
+			log.Printf("seed: %s: %v", code, err)
+			failed++
+			continue
+		}
+		if l.Password != "" {
+			if err := checkPasswordStrength(l.Password); err != nil {
+				log.Printf("seed: %s: %v", code, err)
+				failed++
+				continue
+			}
+			h, err := hashLinkPassword(l.Password)
+			if err != nil {
+				log.Printf("seed: %s: %v", code, err)
+				failed++
+				continue
+			}
+			rec.PasswordHash = h
+		}
+		if err := insertSeed(code, rec, l.importRow); isUniqueViolation(err) {
+			skipped++
+		} else if err != nil {
+			return fmt.Errorf("seed %s: %w", code, err)
+		} else {
+			seeded++
+		}
+	}
+	log.Printf("seed: %s: %d seeded, %d already present, %d invalid", path, seeded, skipped, failed)
+	return nil
+}
+
+// insertSeed stores one seeded link with its use_count and created_at.
+func insertSeed(code string, rec urlRecord, in importRow) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := insertURL(tx, code, rec); err != nil {
+		return err
+	}
+	if err := restoreImportCounters(tx, code, in, false); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
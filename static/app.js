@@ -1,10 +1,31 @@
 /* ── modals ── */
+// Focus moves into an opened modal and back to whatever opened it on close.
+let modalReturnFocus = null;
+const focusableSelector =
+  'button, [href], input:not([type="hidden"]), select, textarea, [tabindex]:not([tabindex="-1"])';
+
 function openModal(id) {
-  document.getElementById(id).classList.add("open");
+  const modal = document.getElementById(id);
+  modalReturnFocus = document.activeElement;
+  modal.classList.add("open");
+  const first = [...modal.querySelectorAll(focusableSelector)].find(
+    (el) => el.offsetParent !== null && !el.classList.contains("modal-close"),
+  );
+  (first || modal.querySelector(".modal-close"))?.focus();
 }
 
 function closeModal(id) {
   document.getElementById(id).classList.remove("open");
+  if (modalReturnFocus?.isConnected) modalReturnFocus.focus();
+  modalReturnFocus = null;
+}
+
+// announce reads a short message to screen readers via the live region.
+function announce(msg) {
+  const el = document.getElementById("srStatus");
+  if (!el) return;
+  el.textContent = "";
+  setTimeout(() => (el.textContent = msg), 50);
 }
 
 document.addEventListener("DOMContentLoaded", () => {
@@ -14,15 +35,42 @@ document.addEventListener("DOMContentLoaded", () => {
       if (e.target === el) closeModal(el.id);
     });
   });
-  // Close on Escape
+  // Close on Escape; keep Tab inside an open modal
   document.addEventListener("keydown", (e) => {
     if (e.key === "Escape") {
       document
         .querySelectorAll(".modal-overlay.open")
         .forEach((el) => closeModal(el.id));
+      const menu = document.getElementById("columnsMenu");
+      if (menu && !menu.hidden) closeColumnsMenu(true);
+    }
+    const open = document.querySelector(".modal-overlay.open");
+    if (e.key === "Tab" && open) {
+      const items = [...open.querySelectorAll(focusableSelector)].filter(
+        (el) => el.offsetParent !== null && !el.disabled,
+      );
+      if (!items.length) return;
+      const first = items[0];
+      const last = items[items.length - 1];
+      if (e.shiftKey && document.activeElement === first) {
+        e.preventDefault();
+        last.focus();
+      } else if (!e.shiftKey && document.activeElement === last) {
+        e.preventDefault();
+        first.focus();
+      }
     }
   });
 
+  // Copy links are role="button": Space (and Enter, where there is no
+  // href to follow) copies, like a click.
+  document.addEventListener("keydown", (e) => {
+    const el = e.target.closest?.('a[role="button"][data-url]');
+    if (!el) return;
+    if (e.key === " " || (e.key === "Enter" && !el.hasAttribute("href")))
+      copyLink(e, el);
+  });
+
   // Auto-fill URL input from clipboard if it looks like a URL
   const urlInput = document.getElementById("urlInput");
   if (navigator.clipboard?.readText) {
@@ -40,6 +88,80 @@ document.addEventListener("DOMContentLoaded", () => {
 });
 
 /* ── helpers ── */
+// linkLabel splits "host/code" so compact view can hide the host part.
+function linkLabel(display, code) {
+  if (!display.endsWith("/" + code)) return display;
+  const host = display.slice(0, -code.length);
+  return `<span class="link-host">${host}</span><span class="link-code">${code}</span>`;
+}
+
+function toggleCompact() {
+  const on = document.body.classList.toggle("compact");
+  const btn = document.getElementById("compactToggle");
+  btn.classList.toggle("on", on);
+  btn.setAttribute("aria-pressed", on);
+  localStorage.setItem("compactView", on ? "1" : "");
+}
+
+if (localStorage.getItem("compactView")) {
+  document.body.classList.add("compact");
+  const btn = document.getElementById("compactToggle");
+  btn?.classList.add("on");
+  btn?.setAttribute("aria-pressed", "true");
+}
+
+// Optional table columns; the hidden ones are kept in localStorage and
+// applied as body.hide-col-<name> classes so new rows follow automatically.
+const optionalColumns = ["created", "accessed", "clicks", "tags", "rtype"];
+
+function hiddenColumns() {
+  try {
+    return JSON.parse(localStorage.getItem("hiddenColumns")) || [];
+  } catch {
+    return [];
+  }
+}
+
+function applyColumns() {
+  const hidden = hiddenColumns();
+  optionalColumns.forEach((c) =>
+    document.body.classList.toggle("hide-col-" + c, hidden.includes(c)),
+  );
+  document.querySelectorAll("#columnsMenu input[data-col]").forEach((cb) => {
+    cb.checked = !hidden.includes(cb.dataset.col);
+  });
+}
+
+function setColumn(cb) {
+  const hidden = hiddenColumns().filter((c) => c !== cb.dataset.col);
+  if (!cb.checked) hidden.push(cb.dataset.col);
+  localStorage.setItem("hiddenColumns", JSON.stringify(hidden));
+  applyColumns();
+}
+
+function toggleColumnsMenu(e) {
+  e.stopPropagation();
+  const menu = document.getElementById("columnsMenu");
+  if (!menu.hidden) return closeColumnsMenu(true);
+  menu.hidden = false;
+  document.getElementById("columnsToggle").setAttribute("aria-expanded", "true");
+  menu.querySelector("input")?.focus();
+}
+
+function closeColumnsMenu(refocus) {
+  document.getElementById("columnsMenu").hidden = true;
+  const btn = document.getElementById("columnsToggle");
+  btn.setAttribute("aria-expanded", "false");
+  if (refocus) btn.focus();
+}
+
+document.addEventListener("click", (e) => {
+  const menu = document.getElementById("columnsMenu");
+  if (menu && !menu.hidden && !menu.contains(e.target)) closeColumnsMenu(false);
+});
+
+applyColumns();
+
 function stripScheme(url) {
   return url.replace(/^https?:\/\//, "");
 }
@@ -50,7 +172,13 @@ function formatExpiryDisplay(iso) {
   const now = new Date();
   const expired = d <= now;
   const label = expired ? "Expired" : "Expires";
-  return `<span class="${expired ? "expired" : ""}">${label}: ${d.toLocaleString()}</span>`;
+  let shown;
+  try {
+    shown = d.toLocaleString(undefined, { timeZone: document.body.dataset.tz });
+  } catch {
+    shown = d.toLocaleString(); // zone unknown to this browser
+  }
+  return `<span class="${expired ? "expired" : ""}">${label}: ${shown}</span>`;
 }
 
 /* ── click-to-copy link ── */
@@ -63,28 +191,45 @@ function copyLink(e, el) {
     .writeText(url)
     .then(() => {
       el.classList.add("copied");
+      announce("Copied " + url);
       setTimeout(() => el.classList.remove("copied"), 1500);
     })
     .catch(() => {});
 }
 
 /* ── redirect type ── */
+// resetRedirectType selects the default_redirect_type setting in the form.
+function resetRedirectType() {
+  const radio = document.querySelector(
+    `input[name="redirectType"][value="${document.body.dataset.defaultRtype}"]`,
+  );
+  if (!radio) return;
+  radio.checked = true;
+  onRedirectType(radio);
+}
+
+resetRedirectType();
+
 function onRedirectType(radio) {
   const isJs = radio.value === "js";
-  const isMeta = radio.value === "meta";
+  const isApp = radio.value === "applink";
   document.getElementById("ogSection").style.display =
-    isJs || isMeta ? "" : "none";
+    radio.value === "redirect" ? "none" : "";
   document.getElementById("passwordSection").style.display =
     isJs ? "" : "none";
+  document.getElementById("appLinkSection").style.display =
+    isApp ? "" : "none";
 }
 
 function onEditRedirectType(radio) {
   const isJs = radio.value === "js";
-  const isMeta = radio.value === "meta";
+  const isApp = radio.value === "applink";
   document.getElementById("editOgSection").style.display =
-    isJs || isMeta ? "" : "none";
+    radio.value === "redirect" ? "none" : "";
   document.getElementById("editPasswordSection").style.display =
     isJs ? "" : "none";
+  document.getElementById("editAppLinkSection").style.display =
+    isApp ? "" : "none";
 }
 
 let editPasswordCleared = false;
@@ -94,6 +239,27 @@ function clearEditPassword() {
   document.getElementById("editPassword").value = "";
   document.getElementById("editPassword").placeholder = "No password (cleared)";
   document.getElementById("editClearPwBtn").style.display = "none";
+  document.getElementById("editPwState").textContent =
+    "Password will be removed on save.";
+}
+
+// setPwBadge shows or hides the lock badge next to a row's public link.
+function setPwBadge(code, on) {
+  const pubLinkEl = document.getElementById("pub-link-" + code);
+  if (!pubLinkEl) return;
+  const linkLine = pubLinkEl.closest(".link-line");
+  let badge = linkLine.querySelector(".pw-badge");
+  if (on && !badge) {
+    badge = document.createElement("span");
+    badge.className = "pw-badge";
+    badge.title = "Password protected";
+    badge.setAttribute("role", "img");
+    badge.setAttribute("aria-label", "Password protected");
+    badge.textContent = "🔒";
+    linkLine.appendChild(badge);
+  } else if (!on && badge) {
+    badge.remove();
+  }
 }
 
 function clearEditExpires() {
@@ -118,45 +284,93 @@ function onToggle() {
 }
 
 /* ── shorten ── */
-async function shorten(e) {
-  e.preventDefault();
-  const pub = document.getElementById("chkPublic").checked;
-  const int_ = document.getElementById("chkInternal").checked;
-  if (!pub && !int_) {
-    document.getElementById("toggleErr").style.display = "";
-    return;
-  }
+// parseTags splits a comma-separated tags field the way the server
+// normalizes tags: trimmed, lowercased, no blanks or duplicates.
+function parseTags(value) {
+  const tags = [];
+  value.split(",").forEach((t) => {
+    t = t.trim().toLowerCase();
+    if (t && !tags.includes(t)) tags.push(t);
+  });
+  return tags;
+}
+
+// tagChips renders server-validated tags, which never need escaping.
+function tagChips(tags) {
+  return tags.map((t) => `<span class="tag-chip">${t}</span>`).join("");
+}
 
+function formPayload() {
   const url = document.getElementById("urlInput").value.trim();
   const alias = document.getElementById("aliasInput").value.trim();
   const redirectType =
     document.querySelector('input[name="redirectType"]:checked')?.value ||
     "redirect";
-  const resultEl = document.getElementById("result");
-  resultEl.innerHTML = "";
-
   const expiresLocal = document.getElementById("expiresInput").value;
   const payload = {
     url,
-    public_enabled: pub,
-    internal_enabled: int_,
+    public_enabled: document.getElementById("chkPublic").checked,
+    internal_enabled: document.getElementById("chkInternal").checked,
     redirect_type: redirectType,
     og_title: document.getElementById("ogTitle").value.trim(),
     og_description: document.getElementById("ogDescription").value.trim(),
     og_image: document.getElementById("ogImage").value.trim(),
     password: document.getElementById("passwordInput").value,
+    password_hint: document.getElementById("passwordHintInput").value.trim(),
     description: document.getElementById("descInput").value.trim(),
     expires_at: expiresLocal ? new Date(expiresLocal).toISOString() : "",
     max_uses: parseInt(document.getElementById("maxUsesInput").value, 10) || 0,
+    expire_after_idle: document.getElementById("idleInput").value.trim(),
+    no_analytics: document.getElementById("noAnalyticsInput").checked,
+    path_forward: document.getElementById("pathForwardInput").checked,
+    forward_query: document.getElementById("forwardQueryInput").checked,
+    tags: parseTags(document.getElementById("tagsInput").value),
+    fetch_og: document.getElementById("ogFetchInput").checked,
   };
+  if (redirectType === "applink") {
+    payload.ios_url = document.getElementById("iosUrlInput").value.trim();
+    payload.android_url = document
+      .getElementById("androidUrlInput")
+      .value.trim();
+  }
   if (alias) payload.custom_code = alias;
+  return payload;
+}
 
-  try {
-    const res = await fetch("/shorten", {
-      method: "POST",
+// linkRequest builds the fetch options for a create/patch call: plain JSON,
+// or multipart with the JSON in "payload" when an og:image file is chosen.
+function linkRequest(method, payload, fileInput) {
+  const file = fileInput?.files[0];
+  if (!file)
+    return {
+      method,
       headers: { "Content-Type": "application/json" },
       body: JSON.stringify(payload),
-    });
+    };
+  const fd = new FormData();
+  fd.append("payload", JSON.stringify(payload));
+  fd.append("og_image_file", file);
+  return { method, body: fd };
+}
+
+async function shorten(e) {
+  e.preventDefault();
+  const pub = document.getElementById("chkPublic").checked;
+  const int_ = document.getElementById("chkInternal").checked;
+  if (!pub && !int_) {
+    document.getElementById("toggleErr").style.display = "";
+    return;
+  }
+
+  const resultEl = document.getElementById("result");
+  resultEl.innerHTML = "";
+  const payload = formPayload();
+
+  try {
+    const res = await fetch(
+      "/shorten",
+      linkRequest("POST", payload, document.getElementById("ogImageFile")),
+    );
     const data = await res.json();
     if (!res.ok) {
       resultEl.innerHTML =
@@ -175,16 +389,27 @@ async function shorten(e) {
     // Reset form
     document.getElementById("urlInput").value = "";
     document.getElementById("aliasInput").value = "";
+    checkAlias("");
     document.getElementById("ogTitle").value = "";
     document.getElementById("ogDescription").value = "";
     document.getElementById("ogImage").value = "";
-    document.getElementById("rtypeRedirect").checked = true;
-    document.getElementById("ogSection").style.display = "none";
+    document.getElementById("ogImageFile").value = "";
+    document.getElementById("ogFetchInput").checked = false;
     document.getElementById("passwordInput").value = "";
+    document.getElementById("passwordHintInput").value = "";
     document.getElementById("passwordSection").style.display = "none";
+    document.getElementById("iosUrlInput").value = "";
+    document.getElementById("androidUrlInput").value = "";
+    document.getElementById("appLinkSection").style.display = "none";
+    resetRedirectType();
     document.getElementById("descInput").value = "";
+    document.getElementById("tagsInput").value = "";
     document.getElementById("expiresInput").value = "";
     document.getElementById("maxUsesInput").value = "";
+    document.getElementById("idleInput").value = "";
+    document.getElementById("noAnalyticsInput").checked = false;
+    document.getElementById("pathForwardInput").checked = false;
+    document.getElementById("forwardQueryInput").checked = false;
 
     // Insert new row at top of table
     insertNewRow(data);
@@ -194,74 +419,125 @@ async function shorten(e) {
   }
 }
 
-function insertNewRow(data) {
+// originalCell renders the destination column: the page title when one has
+// been fetched, with the (truncated) URL beneath it, else just the URL.
+function originalCell(longURL, title, desc) {
+  const esc = (v) => v.replace(/&/g, "&amp;").replace(/</g, "&lt;");
+  const short = longURL.length > 55 ? longURL.slice(0, 55) + "…" : longURL;
+  return (
+    `<a href="${longURL}" target="_blank" style="color:#58a6ff">${title ? esc(title) : short}</a>` +
+    (title ? `<div class="url-text">${short}</div>` : "") +
+    (desc ? `<div class="desc-text">${esc(desc)}</div>` : "")
+  );
+}
+
+// linkRow builds a table row like the server-rendered ones from link JSON.
+// Disabled links have no URL in the JSON, so theirs is rebuilt from the
+// bases on <body>; fresh rows show "just now" as their creation time.
+function linkRow(data, fresh) {
   const code = data.code;
   const longURL = data.long_url;
-  const pubUrl = data.alias_url || data.short_url || "";
-  const intUrl = data.internal_url || "";
-  const pubEnabled = !!pubUrl;
-  const intEnabled = !!intUrl;
+  const pubEnabled = !!(data.alias_url || data.short_url);
+  const intEnabled = !!data.internal_url;
+  const pubUrl =
+    data.alias_url || data.short_url || `${document.body.dataset.pubBase}/${code}`;
+  const intUrl =
+    data.internal_url || `${document.body.dataset.internalHost}/${code}`;
   const redirectType = data.redirect_type || "redirect";
   const desc = data.description || "";
   const expiresAt = data.expires_at || "";
   const maxUses = data.max_uses || 0;
   const useCount = data.use_count || 0;
 
-  const shortLong = longURL.length > 55 ? longURL.slice(0, 55) + "…" : longURL;
   const pubDisplay = stripScheme(pubUrl);
 
+  const copyAttrs = (url) => `role="button" tabindex="0" aria-label="Copy ${url}"`;
   const pubLink = pubEnabled
-    ? `<a href="${pubUrl}" target="_blank" data-url="${pubUrl}" onclick="copyLink(event,this)" id="pub-link-${code}">${pubDisplay}</a>`
-    : `<a class="disabled" data-url="${pubUrl}" onclick="copyLink(event,this)" id="pub-link-${code}">${pubDisplay}</a>`;
+    ? `<a href="${pubUrl}" target="_blank" data-url="${pubUrl}" onclick="copyLink(event,this)" ${copyAttrs(pubUrl)} id="pub-link-${code}">${linkLabel(pubDisplay, code)}</a>`
+    : `<a class="disabled" aria-disabled="true" data-url="${pubUrl}" onclick="copyLink(event,this)" ${copyAttrs(pubUrl)} id="pub-link-${code}">${linkLabel(pubDisplay, code)}</a>`;
   const intDisplay = stripScheme(intUrl);
   const intLink = intEnabled
-    ? `<a data-url="${intDisplay}" onclick="copyLink(event,this)" id="int-link-${code}">${intDisplay}</a>`
-    : `<a class="disabled" data-url="${intDisplay}" onclick="copyLink(event,this)" id="int-link-${code}">${intDisplay}</a>`;
-  const pubToggle = `<button class="row-toggle tag-public ${pubEnabled ? "on" : "off"}" onclick="rowToggle('${code}','public',this)" title="Toggle public link">P</button>`;
-  const intToggle = `<button class="row-toggle tag-internal ${intEnabled ? "on" : "off"}" onclick="rowToggle('${code}','internal',this)" title="Toggle internal link">I</button>`;
+    ? `<a data-url="${intDisplay}" onclick="copyLink(event,this)" ${copyAttrs(intDisplay)} id="int-link-${code}">${linkLabel(intDisplay, code)}</a>`
+    : `<a class="disabled" aria-disabled="true" data-url="${intDisplay}" onclick="copyLink(event,this)" ${copyAttrs(intDisplay)} id="int-link-${code}">${linkLabel(intDisplay, code)}</a>`;
+  const pubToggle = `<button class="row-toggle tag-public ${pubEnabled ? "on" : "off"}" onclick="rowToggle('${code}','public',this)" title="Toggle public link" aria-label="Public link ${code} enabled" aria-pressed="${pubEnabled}">P</button>`;
+  const intToggle = `<button class="row-toggle tag-internal ${intEnabled ? "on" : "off"}" onclick="rowToggle('${code}','internal',this)" title="Toggle internal link" aria-label="Internal link ${code} enabled" aria-pressed="${intEnabled}">I</button>`;
   const metaBadge =
     redirectType === "meta"
       ? `<span class="rtype-badge">META</span>`
       : redirectType === "js"
         ? `<span class="rtype-badge rtype-badge--js">JS</span>`
-        : "";
+        : redirectType === "applink"
+          ? `<span class="rtype-badge rtype-badge--app">APP</span>`
+          : "";
+  const pwBadge = data.has_password
+    ? `<span class="pw-badge" title="Password protected" role="img" aria-label="Password protected">🔒</span>`
+    : "";
 
   const longURLEscaped = longURL.replace(/'/g, "\\'");
   const tr = document.createElement("tr");
   tr.id = "row-" + code;
-  tr.className = "row-new";
+  if (data.is_expired || data.uses_exhausted) tr.className = "row-expired";
+  tr.dataset.longUrl = longURL;
+  tr.dataset.title = data.title || "";
   tr.dataset.rtype = redirectType;
   tr.dataset.ogTitle = data.og_title || "";
   tr.dataset.ogDesc = data.og_description || "";
   tr.dataset.ogImage = data.og_image || "";
+  tr.dataset.ogUpload = data.has_og_image_upload ? "true" : "false";
   tr.dataset.hasPassword = data.has_password ? "true" : "false";
   tr.dataset.desc = desc;
+  tr.dataset.tags = (data.tags || []).join(",");
   tr.dataset.expiresAt = expiresAt;
   tr.dataset.maxUses = maxUses;
   tr.dataset.useCount = useCount;
+  tr.dataset.noAnalytics = data.no_analytics ? "true" : "false";
+  tr.dataset.pathForward = data.path_forward ? "true" : "false";
+  tr.dataset.forwardQuery = data.forward_query ? "true" : "false";
+  tr.dataset.idle = data.expire_after_idle || "";
+  tr.dataset.utmSource = data.utm_source || "";
+  tr.dataset.utmMedium = data.utm_medium || "";
+  tr.dataset.utmCampaign = data.utm_campaign || "";
+  tr.dataset.iosUrl = data.ios_url || "";
+  tr.dataset.androidUrl = data.android_url || "";
+  tr.dataset.passwordHint = data.password_hint || "";
   tr.innerHTML = `
     <td class="td-links">
-      <div class="link-line">${pubToggle}${pubLink}${metaBadge}</div>
+      <div class="link-line">${pubToggle}${pubLink}${metaBadge}${pwBadge}</div>
       <div class="link-line">${intToggle}${intLink}</div>
     </td>
-    <td class="td-original" id="orig-${code}">
-      <a href="${longURL}" target="_blank" style="color:#58a6ff">${shortLong}</a>
-      ${desc ? `<div class="desc-text">${desc.replace(/&/g,"&amp;").replace(/</g,"&lt;")}</div>` : ""}
-    </td>
-    <td class="td-date">just now${expiresAt ? `<div class="expires-text">${formatExpiryDisplay(expiresAt)}</div>` : ""}${maxUses ? `<div class="uses-text">${useCount} / ${maxUses} uses</div>` : ""}</td>
+    <td class="td-original" id="orig-${code}">${originalCell(longURL, data.title, desc)}</td>
+    <td class="td-date col-created">${fresh ? "just now" : data.created_display}${expiresAt ? `<div class="expires-text">${formatExpiryDisplay(expiresAt)}</div>` : ""}${maxUses ? `<div class="uses-text${data.uses_exhausted ? " exhausted" : ""}">${useCount} / ${maxUses} uses</div>` : ""}</td>
+    <td class="td-date col-accessed">${data.last_accessed_display || "never"}</td>
+    <td class="td-clicks col-clicks">${data.clicks || 0}</td>
+    <td class="td-tags col-tags">${tagChips(data.tags || [])}</td>
+    <td class="td-rtype col-rtype">${redirectType}</td>
     <td class="td-actions">
         <div class="act-row">
-          <button class="action-btn btn-qr"    onclick="showQR('${code}')"                    title="QR code">
-            <svg width="13" height="13" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2.2"><rect x="3" y="3" width="7" height="7" rx="1"/><rect x="14" y="3" width="7" height="7" rx="1"/><rect x="3" y="14" width="7" height="7" rx="1"/><rect x="14" y="14" width="3" height="3"/><rect x="19" y="14" width="2" height="2"/><rect x="14" y="19" width="2" height="2"/><rect x="19" y="19" width="2" height="2"/></svg>
+          <button class="action-btn btn-qr"    onclick="showQR('${code}')"                    title="QR code" aria-label="QR code for ${code}">
+            <svg aria-hidden="true" width="13" height="13" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2.2"><rect x="3" y="3" width="7" height="7" rx="1"/><rect x="14" y="3" width="7" height="7" rx="1"/><rect x="3" y="14" width="7" height="7" rx="1"/><rect x="14" y="14" width="3" height="3"/><rect x="19" y="14" width="2" height="2"/><rect x="14" y="19" width="2" height="2"/><rect x="19" y="19" width="2" height="2"/></svg>
           </button>
-          <button class="action-btn btn-edit"  onclick="startEdit('${code}','${longURLEscaped}')" title="Edit">
-            <svg width="13" height="13" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2.2"><path d="M11 4H4a2 2 0 0 0-2 2v14a2 2 0 0 0 2 2h14a2 2 0 0 0 2-2v-7"/><path d="M18.5 2.5a2.121 2.121 0 0 1 3 3L12 15l-4 1 1-4 9.5-9.5z"/></svg>
+          <button class="action-btn btn-curl"  onclick="copyRowCurl('${code}',this)"             title="Copy as curl" aria-label="Copy curl command for ${code}">
+            <svg aria-hidden="true" width="13" height="13" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2.2"><polyline points="4 17 10 11 4 5"/><line x1="12" y1="19" x2="20" y2="19"/></svg>
           </button>
-          <button class="action-btn btn-delete" onclick="deleteRow('${code}')"                 title="Delete">
-            <svg width="13" height="13" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2.2"><polyline points="3 6 5 6 21 6"/><path d="M19 6l-1 14a2 2 0 0 1-2 2H8a2 2 0 0 1-2-2L5 6"/><path d="M10 11v6"/><path d="M14 11v6"/><path d="M9 6V4a1 1 0 0 1 1-1h4a1 1 0 0 1 1 1v2"/></svg>
+          <button class="action-btn btn-edit"  onclick="startEdit('${code}','${longURLEscaped}')" title="Edit" aria-label="Edit ${code}">
+            <svg aria-hidden="true" width="13" height="13" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2.2"><path d="M11 4H4a2 2 0 0 0-2 2v14a2 2 0 0 0 2 2h14a2 2 0 0 0 2-2v-7"/><path d="M18.5 2.5a2.121 2.121 0 0 1 3 3L12 15l-4 1 1-4 9.5-9.5z"/></svg>
+          </button>
+          <button class="action-btn btn-delete" onclick="deleteRow('${code}')"                 title="Delete" aria-label="Delete ${code}">
+            <svg aria-hidden="true" width="13" height="13" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2.2"><polyline points="3 6 5 6 21 6"/><path d="M19 6l-1 14a2 2 0 0 1-2 2H8a2 2 0 0 1-2-2L5 6"/><path d="M10 11v6"/><path d="M14 11v6"/><path d="M9 6V4a1 1 0 0 1 1-1h4a1 1 0 0 1 1 1v2"/></svg>
           </button>
         </div>
     </td>`;
+  tr.querySelector(".td-original").title = desc ? `${longURL} — ${desc}` : longURL;
+  tr.querySelector(".td-date").title =
+    `Created ${data.created_at}` +
+    (expiresAt ? ` · Expires ${expiresAt}` : "") +
+    (maxUses ? ` · ${useCount} / ${maxUses} uses` : "");
+  return tr;
+}
+
+function insertNewRow(data) {
+  const tr = linkRow(data, true);
+  tr.classList.add("row-new");
 
   let tbody = document.getElementById("linksBody");
   if (!tbody) {
@@ -270,38 +546,223 @@ function insertNewRow(data) {
     const tableWrap = emptyState.parentNode;
     emptyState.remove();
     tableWrap.innerHTML =
-      "<table><thead><tr><th>Links</th><th>Original</th><th>Created</th><th>Actions</th></tr></thead>" +
+      '<table><thead><tr><th>Links</th><th>Original</th><th class="col-created">Created</th><th class="col-accessed">Last used</th>' +
+      '<th class="col-clicks">Clicks</th><th class="col-tags">Tags</th><th class="col-rtype">Type</th><th>Actions</th></tr></thead>' +
       '<tbody id="linksBody"></tbody></table>';
     tbody = document.getElementById("linksBody");
   }
 
   tbody.insertBefore(tr, tbody.firstChild);
+  addToCount(1);
+}
 
-  // Update count label
+// addToCount adjusts the total in the count label, which counts every link,
+// not just the rows loaded so far.
+function addToCount(n) {
   const label = document.getElementById("countLabel");
-  if (label) {
-    const total = tbody.querySelectorAll("tr").length;
-    label.textContent = total + " entries";
+  if (!label) return;
+  label.dataset.total = (parseInt(label.dataset.total, 10) || 0) + n;
+  label.textContent = label.dataset.total + " entries";
+}
+
+/* ── load more ── */
+// The page renders the first page of links; loadMore appends the next one
+// from GET /urls in the same order (and timezone). Rows already in the table
+// (new links, search results) are skipped.
+async function loadMore(btn) {
+  const page = new URLSearchParams(location.search);
+  const q = new URLSearchParams({
+    limit: btn.dataset.limit,
+    offset: btn.dataset.offset,
+  });
+  for (const k of ["sort", "order", "tz"]) if (page.get(k)) q.set(k, page.get(k));
+  btn.disabled = true;
+  try {
+    const res = await fetch("/urls?" + q);
+    if (!res.ok) return;
+    const links = await res.json();
+    const tbody = document.getElementById("linksBody");
+    for (const l of links)
+      if (!document.getElementById("row-" + l.code)) tbody.append(linkRow(l));
+    const offset = parseInt(btn.dataset.offset, 10) + links.length;
+    btn.dataset.offset = offset;
+    const total = parseInt(res.headers.get("X-Total-Count"), 10);
+    if (!links.length || offset >= total) btn.parentNode.remove();
+    announce(`Loaded ${links.length} more links`);
+  } finally {
+    btn.disabled = false;
   }
 }
 
+/* ── copy as curl ── */
+function shellQuote(s) {
+  return "'" + s.replace(/'/g, "'\\''") + "'";
+}
+
+function curlCommand(method, path, payload) {
+  const base = (document.body.dataset.apiBase || location.origin).replace(
+    /\/+$/,
+    "",
+  );
+  let cmd = `curl -X ${method} ${shellQuote(base + path)}`;
+  if (payload !== undefined)
+    cmd += ` -H 'Content-Type: application/json' -d ${shellQuote(JSON.stringify(payload))}`;
+  return cmd;
+}
+
+function copyCurl(cmd, btn) {
+  if (!navigator.clipboard?.writeText) return;
+  navigator.clipboard
+    .writeText(cmd)
+    .then(() => {
+      btn.classList.add("copied");
+      setTimeout(() => btn.classList.remove("copied"), 1500);
+    })
+    .catch(() => {});
+}
+
+function copyFormCurl(btn) {
+  const payload = formPayload();
+  // Never put a link password into a copied shell command.
+  delete payload.password;
+  copyCurl(curlCommand("POST", "/shorten", payload), btn);
+}
+
+// copyRowCurl copies a POST /shorten command that recreates the row's link.
+function copyRowCurl(code, btn) {
+  const row = document.getElementById("row-" + code);
+  if (!row) return;
+  const d = row.dataset;
+  const payload = {
+    url: d.longUrl,
+    custom_code: code,
+    public_enabled: row.querySelector(".tag-public").classList.contains("on"),
+    internal_enabled: row
+      .querySelector(".tag-internal")
+      .classList.contains("on"),
+    redirect_type: d.rtype || "redirect",
+  };
+  if (d.ogTitle) payload.og_title = d.ogTitle;
+  if (d.ogDesc) payload.og_description = d.ogDesc;
+  if (d.ogImage) payload.og_image = d.ogImage;
+  if (d.desc) payload.description = d.desc;
+  if (d.tags) payload.tags = d.tags.split(",");
+  if (d.expiresAt) payload.expires_at = d.expiresAt;
+  if (parseInt(d.maxUses || "0", 10))
+    payload.max_uses = parseInt(d.maxUses, 10);
+  if (d.noAnalytics === "true") payload.no_analytics = true;
+  if (d.pathForward === "true") payload.path_forward = true;
+  if (d.forwardQuery === "true") payload.forward_query = true;
+  if (d.idle) payload.expire_after_idle = d.idle;
+  if (d.utmSource) payload.utm_source = d.utmSource;
+  if (d.utmMedium) payload.utm_medium = d.utmMedium;
+  if (d.utmCampaign) payload.utm_campaign = d.utmCampaign;
+  if (d.iosUrl) payload.ios_url = d.iosUrl;
+  if (d.androidUrl) payload.android_url = d.androidUrl;
+  if (d.passwordHint) payload.password_hint = d.passwordHint;
+  copyCurl(curlCommand("POST", "/shorten", payload), btn);
+}
+
+/* ── alias availability ── */
+// checkAlias asks GET /available/{code} whether the alias is free while it is
+// typed, debounced like the search; only the latest answer is shown.
+let aliasTimer = null;
+let aliasSeq = 0;
+
+function checkAlias(alias) {
+  clearTimeout(aliasTimer);
+  const seq = ++aliasSeq;
+  const el = document.getElementById("aliasStatus");
+  alias = alias.trim();
+  if (!alias) {
+    el.textContent = "";
+    el.className = "hint";
+    return;
+  }
+  aliasTimer = setTimeout(async () => {
+    let res, data;
+    try {
+      res = await fetch("/available/" + encodeURIComponent(alias));
+      data = await res.json();
+    } catch {
+      return;
+    }
+    if (seq !== aliasSeq || (!res.ok && res.status !== 400)) return;
+    let msg = "This alias is not allowed";
+    if (res.status === 400) msg = "Invalid alias: " + data.error;
+    else if (data.available) msg = "Available";
+    else if (data.reason === "taken") msg = "Already taken";
+    el.textContent = msg;
+    el.className = "hint " + (data.available ? "alias-ok" : "alias-bad");
+  }, 300);
+}
+
 /* ── search / filter ── */
+// filterRows asks GET /urls?q= which links match, so the search covers the
+// description too, then shows just those rows, adding any not loaded yet.
+// Typing is debounced, and only the latest request's answer is applied.
+let filterTimer = null;
+let filterSeq = 0;
+
 function filterRows(q) {
-  const term = q.trim().toLowerCase();
-  const rows = document.querySelectorAll("tbody tr");
-  let visible = 0;
-  rows.forEach((row) => {
-    const show = !term || row.textContent.toLowerCase().includes(term);
+  clearTimeout(filterTimer);
+  filterTimer = setTimeout(() => runFilter(q.trim()), 200);
+}
+
+async function runFilter(term) {
+  const seq = ++filterSeq;
+  const rows = document.querySelectorAll("#linksBody tr");
+  let matches = null;
+  let matched = rows.length;
+  if (term) {
+    try {
+      const res = await fetch("/urls?q=" + encodeURIComponent(term));
+      if (!res.ok) throw new Error(res.status);
+      const data = await res.json();
+      matches = new Set(data.map((l) => l.code));
+      matched = parseInt(res.headers.get("X-Total-Count"), 10) || data.length;
+      if (seq !== filterSeq) return;
+      // Matches beyond the loaded pages get rows of their own.
+      const tbody = document.getElementById("linksBody");
+      for (const l of data)
+        if (tbody && !document.getElementById("row-" + l.code)) {
+          const tr = linkRow(l);
+          tr.dataset.extra = "true";
+          tbody.append(tr);
+        }
+    } catch {
+      // Offline or erroring server: fall back to matching the visible text.
+      const t = term.toLowerCase();
+      matches = new Set(
+        [...rows]
+          .filter((row) => row.textContent.toLowerCase().includes(t))
+          .map((row) => row.id.slice("row-".length)),
+      );
+      matched = matches.size;
+    }
+  }
+  if (seq !== filterSeq) return;
+  document.querySelectorAll("#linksBody tr").forEach((row) => {
+    const show = !matches || matches.has(row.id.slice("row-".length));
     row.style.display = show ? "" : "none";
-    if (show) visible++;
   });
   const label = document.getElementById("countLabel");
   if (label)
     label.textContent =
-      (term ? visible + " of " + rows.length : rows.length) + " entries";
+      (term ? matched + " of " + label.dataset.total : label.dataset.total) +
+      " entries";
+  if (term) announce(matched + " matching links");
 }
 
 /* ── settings modal ── */
+function hostList(id) {
+  return document
+    .getElementById(id)
+    .value.split(",")
+    .map((h) => h.trim())
+    .filter(Boolean);
+}
+
 async function saveSettings() {
   const payload = {
     public_base: document.getElementById("cfgPublicBase").value.trim(),
@@ -309,7 +770,34 @@ async function saveSettings() {
     internal_host: document.getElementById("cfgInternalHost").value.trim(),
     alias_host: document.getElementById("cfgAliasHost").value.trim(),
     public_api_host: document.getElementById("cfgPublicAPIHost").value.trim(),
+    internal_root_redirect: document
+      .getElementById("cfgInternalRoot")
+      .value.trim(),
+    not_found_redirect: document.getElementById("cfgNotFound").value.trim(),
+    internal_not_found_redirect: document
+      .getElementById("cfgInternalNotFound")
+      .value.trim(),
+    expiry_grace:
+      document.getElementById("cfgExpiryGrace").value.trim() || "0s",
+    site_title: document.getElementById("cfgSiteTitle").value.trim(),
+    favicon_url: document.getElementById("cfgFaviconURL").value.trim(),
+    timezone: document.getElementById("cfgTimezone").value.trim() || "UTC",
+    webhook_url: document.getElementById("cfgWebhookURL").value.trim(),
+    default_redirect_type: document.querySelector(
+      'input[name="cfgDefaultRedirectType"]:checked',
+    ).value,
+    blocked_hosts: hostList("cfgBlockedHosts"),
+    allowed_hosts: hostList("cfgAllowedHosts"),
+    maintenance: document.getElementById("cfgMaintenance").checked,
+    canonical_link: document.getElementById("cfgCanonicalLink").checked,
+    noindex: document.getElementById("cfgNoindex").checked,
+    forward_query_prefer_destination:
+      document.getElementById("cfgPreferDestQuery").checked,
   };
+  const adminPw = document.getElementById("cfgAdminPassword").value;
+  if (document.getElementById("cfgAdminPasswordRemove")?.checked)
+    payload.admin_password = "";
+  else if (adminPw) payload.admin_password = adminPw;
   const res = await fetch("/settings", {
     method: "PATCH",
     headers: { "Content-Type": "application/json" },
@@ -320,7 +808,19 @@ async function saveSettings() {
   if (res.ok) {
     fb.textContent = "Saved!";
     fb.style.color = "#56d364";
-    setTimeout(() => closeModal("modalSettings"), 800);
+    const title = payload.site_title || "URL Shortener";
+    document.title = title;
+    document.querySelector(".panel-left h1").textContent = title;
+    document.querySelector("link[rel=icon]").href =
+      payload.favicon_url || "/static/favicon.svg";
+    // Turning sign-in on or off changes the page (sign-out button, hints),
+    // and the table's times are rendered in the time zone.
+    if (
+      "admin_password" in payload ||
+      payload.timezone !== document.body.dataset.tz
+    )
+      setTimeout(() => location.reload(), 800);
+    else setTimeout(() => closeModal("modalSettings"), 800);
   } else {
     fb.textContent = "Error saving.";
     fb.style.color = "#f85149";
@@ -330,6 +830,11 @@ async function saveSettings() {
   }, 2500);
 }
 
+async function logout() {
+  await fetch("/logout", { method: "POST" });
+  location.reload();
+}
+
 /* ── QR code modal ── */
 let currentQRCode = null;
 
@@ -384,9 +889,12 @@ async function rowToggle(code, type, btn) {
   if (!res.ok) return;
   btn.classList.toggle("on", newVal);
   btn.classList.toggle("off", !newVal);
+  btn.setAttribute("aria-pressed", newVal);
+  announce(`${type === "public" ? "Public" : "Internal"} link ${code} ${newVal ? "enabled" : "disabled"}`);
   const links = row.querySelectorAll(".td-links a");
   const idx = type === "public" ? 0 : 1;
   links[idx].classList.toggle("disabled", !newVal);
+  links[idx].setAttribute("aria-disabled", !newVal);
   if (type === "public") {
     if (newVal) {
       links[idx].setAttribute("href", links[idx].dataset.url);
@@ -419,22 +927,45 @@ function startEdit(code, currentURL) {
   document.getElementById("editRtypeRedirect").checked = rtype === "redirect";
   document.getElementById("editRtypeMeta").checked = rtype === "meta";
   document.getElementById("editRtypeJs").checked = rtype === "js";
+  document.getElementById("editRtypeApplink").checked = rtype === "applink";
   document.getElementById("editOgSection").style.display =
-    rtype === "meta" || rtype === "js" ? "" : "none";
+    rtype === "redirect" ? "none" : "";
+  document.getElementById("editAppLinkSection").style.display =
+    rtype === "applink" ? "" : "none";
+  document.getElementById("editIosUrl").value = row?.dataset.iosUrl || "";
+  document.getElementById("editAndroidUrl").value =
+    row?.dataset.androidUrl || "";
   document.getElementById("editDescInput").value = row?.dataset.desc || "";
+  document.getElementById("editTagsInput").value = (row?.dataset.tags || "")
+    .split(",")
+    .filter(Boolean)
+    .join(", ");
+  document.getElementById("editUtmSource").value = row?.dataset.utmSource || "";
+  document.getElementById("editUtmMedium").value = row?.dataset.utmMedium || "";
+  document.getElementById("editUtmCampaign").value =
+    row?.dataset.utmCampaign || "";
   document.getElementById("editOgTitle").value = row?.dataset.ogTitle || "";
   document.getElementById("editOgDescription").value =
     row?.dataset.ogDesc || "";
   document.getElementById("editOgImage").value = row?.dataset.ogImage || "";
+  document.getElementById("editOgImageFile").value = "";
+  document.getElementById("editOgImageRemove").checked = false;
+  document.getElementById("editOgUploadRemove").style.display =
+    row?.dataset.ogUpload === "true" ? "" : "none";
   document.getElementById("editPasswordSection").style.display =
     rtype === "js" ? "" : "none";
   const pwInput = document.getElementById("editPassword");
   const clearBtn = document.getElementById("editClearPwBtn");
   pwInput.value = "";
+  document.getElementById("editPasswordHint").value =
+    row?.dataset.passwordHint || "";
   pwInput.placeholder = hasPassword
     ? "New password (leave blank to keep)"
     : "Set password (optional)";
   clearBtn.style.display = hasPassword ? "" : "none";
+  document.getElementById("editPwState").textContent = hasPassword
+    ? "🔒 This link is password protected."
+    : "No password set.";
 
   const expiresAt = row?.dataset.expiresAt || "";
   const editExpires = document.getElementById("editExpiresInput");
@@ -456,11 +987,39 @@ function startEdit(code, currentURL) {
   document.getElementById("editMaxUsesInput").value = maxUses || "";
   const hint = document.getElementById("editUseCountHint");
   hint.textContent = maxUses ? `Current uses: ${useCount} of ${maxUses}` : useCount ? `Current uses: ${useCount}` : "";
+  document.getElementById("editNoAnalyticsInput").checked =
+    row?.dataset.noAnalytics === "true";
+  document.getElementById("editPathForwardInput").checked =
+    row?.dataset.pathForward === "true";
+  document.getElementById("editForwardQueryInput").checked =
+    row?.dataset.forwardQuery === "true";
+  document.getElementById("editIdleInput").value = row?.dataset.idle || "";
 
   openModal("modalEdit");
   setTimeout(() => codeInp.focus(), 50);
 }
 
+// testEditURL opens the destination as typed, before it is saved, so a typo
+// shows up as a broken page here rather than for everyone who clicks.
+function testEditURL() {
+  const inp = document.getElementById("editUrlInput");
+  const fb = document.getElementById("editFeedback");
+  let url;
+  try {
+    url = new URL(inp.value.trim());
+  } catch {}
+  if (!url || (url.protocol !== "http:" && url.protocol !== "https:")) {
+    fb.textContent = "Enter an absolute http(s) URL to test.";
+    fb.style.color = "#f85149";
+    fb.style.display = "";
+    inp.style.borderColor = "#fc8181";
+    return;
+  }
+  fb.style.display = "none";
+  inp.style.borderColor = "";
+  window.open(url.href, "_blank", "noopener");
+}
+
 async function confirmEdit() {
   const newCode = document.getElementById("editCodeInput").value.trim();
   const newURL = document.getElementById("editUrlInput").value.trim();
@@ -473,13 +1032,25 @@ async function confirmEdit() {
   const body = {
     long_url: newURL,
     description: document.getElementById("editDescInput").value.trim(),
+    tags: parseTags(document.getElementById("editTagsInput").value),
     redirect_type: rtype,
     og_title: document.getElementById("editOgTitle").value.trim(),
     og_description: document.getElementById("editOgDescription").value.trim(),
     og_image: document.getElementById("editOgImage").value.trim(),
     expires_at: expiresLocal ? new Date(expiresLocal).toISOString() : "",
     max_uses: parseInt(document.getElementById("editMaxUsesInput").value, 10) || 0,
+    expire_after_idle: document.getElementById("editIdleInput").value.trim(),
+    no_analytics: document.getElementById("editNoAnalyticsInput").checked,
+    path_forward: document.getElementById("editPathForwardInput").checked,
+    forward_query: document.getElementById("editForwardQueryInput").checked,
+    utm_source: document.getElementById("editUtmSource").value.trim(),
+    utm_medium: document.getElementById("editUtmMedium").value.trim(),
+    utm_campaign: document.getElementById("editUtmCampaign").value.trim(),
+    ios_url: document.getElementById("editIosUrl").value.trim(),
+    android_url: document.getElementById("editAndroidUrl").value.trim(),
+    password_hint: document.getElementById("editPasswordHint").value.trim(),
   };
+  const editRow = document.getElementById("row-" + currentEditCode);
   if (rtype === "js") {
     if (editPasswordCleared) {
       body.password = "";
@@ -487,14 +1058,21 @@ async function confirmEdit() {
       const pw = document.getElementById("editPassword").value;
       if (pw) body.password = pw;
     }
+  } else if (editRow?.dataset.hasPassword === "true") {
+    // Only JS redirects can prompt for a password; drop it rather than
+    // leave a stale hash behind on a link that no longer enforces it.
+    body.password = "";
   }
   if (newCode && newCode !== currentEditCode) body.code = newCode;
 
-  const res = await fetch("/urls/" + currentEditCode, {
-    method: "PATCH",
-    headers: { "Content-Type": "application/json" },
-    body: JSON.stringify(body),
-  });
+  const ogFile = document.getElementById("editOgImageFile");
+  if (!ogFile.files.length && document.getElementById("editOgImageRemove").checked)
+    body.remove_og_image_upload = true;
+
+  const res = await fetch(
+    "/urls/" + currentEditCode,
+    linkRequest("PATCH", body, ogFile),
+  );
   if (!res.ok) {
     const data = await res.json().catch(() => ({}));
     const fb = document.getElementById("editFeedback");
@@ -509,19 +1087,12 @@ async function confirmEdit() {
 
   const effectiveCode = body.code || currentEditCode;
 
-  // Update destination URL cell
+  // Update destination URL cell; a new destination drops the fetched title
+  // until the next reload picks up the refetched one.
   const cell = document.getElementById("orig-" + currentEditCode);
-  const short = newURL.length > 55 ? newURL.slice(0, 55) + "…" : newURL;
-  const descSafe = body.description
-    .replace(/&/g, "&amp;")
-    .replace(/</g, "&lt;");
-  cell.innerHTML =
-    '<a href="' +
-    newURL +
-    '" target="_blank" style="color:#58a6ff">' +
-    short +
-    "</a>" +
-    (body.description ? `<div class="desc-text">${descSafe}</div>` : "");
+  const title =
+    editRow && editRow.dataset.longUrl === newURL ? editRow.dataset.title : "";
+  cell.innerHTML = originalCell(newURL, title, body.description);
 
   // If the code changed, rename all code-keyed DOM elements
   if (body.code) {
@@ -533,15 +1104,21 @@ async function confirmEdit() {
     const ib = document.getElementById("int-link-" + oldCode);
     if (pb) {
       pb.id = "pub-link-" + effectiveCode;
-      pb.textContent = pb.textContent.replace(oldCode, effectiveCode);
+      pb.querySelector(".link-code").textContent = effectiveCode;
       pb.dataset.url = pb.dataset.url.replace(oldCode, effectiveCode);
       if (pb.getAttribute("href")) pb.setAttribute("href", pb.dataset.url);
     }
     if (ib) {
       ib.id = "int-link-" + effectiveCode;
-      ib.textContent = ib.textContent.replace(oldCode, effectiveCode);
+      ib.querySelector(".link-code").textContent = effectiveCode;
       ib.dataset.url = ib.dataset.url.replace(oldCode, effectiveCode);
     }
+    row.querySelectorAll("[aria-label]").forEach((el) => {
+      el.setAttribute(
+        "aria-label",
+        el.getAttribute("aria-label").replace(oldCode, effectiveCode),
+      );
+    });
     row.querySelectorAll("[onclick]").forEach((el) => {
       el.setAttribute(
         "onclick",
@@ -555,16 +1132,35 @@ async function confirmEdit() {
   // Update row data attributes + redirect badge
   const rowEl = document.getElementById("row-" + effectiveCode);
   if (rowEl) {
+    rowEl.dataset.longUrl = newURL;
+    rowEl.dataset.title = title;
     rowEl.dataset.rtype = rtype;
     rowEl.dataset.desc = body.description;
+    rowEl.dataset.tags = body.tags.join(",");
+    rowEl.querySelector(".td-tags").innerHTML = tagChips(body.tags);
     rowEl.dataset.ogTitle = body.og_title;
     rowEl.dataset.ogDesc = body.og_description;
     rowEl.dataset.ogImage = body.og_image;
+    if (ogFile.files.length) rowEl.dataset.ogUpload = "true";
+    else if (body.remove_og_image_upload) rowEl.dataset.ogUpload = "false";
     rowEl.dataset.expiresAt = body.expires_at;
     rowEl.dataset.maxUses = body.max_uses;
+    rowEl.dataset.noAnalytics = body.no_analytics ? "true" : "false";
+    rowEl.dataset.pathForward = body.path_forward ? "true" : "false";
+    rowEl.dataset.forwardQuery = body.forward_query ? "true" : "false";
+    rowEl.dataset.idle = body.expire_after_idle;
+    rowEl.dataset.utmSource = body.utm_source;
+    rowEl.dataset.utmMedium = body.utm_medium;
+    rowEl.dataset.utmCampaign = body.utm_campaign;
+    rowEl.dataset.iosUrl = body.ios_url;
+    rowEl.dataset.androidUrl = body.android_url;
+    rowEl.dataset.passwordHint = body.password_hint;
     if (body.password !== undefined) {
       rowEl.dataset.hasPassword = body.password ? "true" : "false";
     }
+    setPwBadge(effectiveCode, rowEl.dataset.hasPassword === "true");
+    const rtypeCell = rowEl.querySelector(".td-rtype");
+    if (rtypeCell) rtypeCell.textContent = rtype;
     // Update expiry display in td-date
     const dateCell = rowEl.querySelector(".td-date");
     if (dateCell) {
@@ -602,17 +1198,24 @@ async function confirmEdit() {
     if (rtype === "meta") {
       if (!badge) {
         badge = document.createElement("span");
-        linkLine.appendChild(badge);
+        linkLine.insertBefore(badge, linkLine.querySelector(".pw-badge"));
       }
       badge.className = "rtype-badge";
       badge.textContent = "META";
     } else if (rtype === "js") {
       if (!badge) {
         badge = document.createElement("span");
-        linkLine.appendChild(badge);
+        linkLine.insertBefore(badge, linkLine.querySelector(".pw-badge"));
       }
       badge.className = "rtype-badge rtype-badge--js";
       badge.textContent = "JS";
+    } else if (rtype === "applink") {
+      if (!badge) {
+        badge = document.createElement("span");
+        linkLine.insertBefore(badge, linkLine.querySelector(".pw-badge"));
+      }
+      badge.className = "rtype-badge rtype-badge--app";
+      badge.textContent = "APP";
     } else if (badge) {
       badge.remove();
     }
@@ -624,14 +1227,94 @@ async function confirmEdit() {
 /* ── delete — modal ── */
 let currentDeleteCode = null;
 
+// deleteConfirm holds the click count the server asked us to echo back
+// before it deletes a popular link.
+let deleteConfirm = null;
+
 function deleteRow(code) {
   currentDeleteCode = code;
+  deleteConfirm = null;
   document.getElementById("deleteModalCode").textContent = code;
+  document.getElementById("deleteModalWarn").style.display = "none";
   openModal("modalDelete");
 }
 
 async function confirmDelete() {
-  const res = await fetch("/urls/" + currentDeleteCode, { method: "DELETE" });
-  if (res.ok) document.getElementById("row-" + currentDeleteCode).remove();
+  let url = "/urls/" + currentDeleteCode;
+  if (deleteConfirm !== null) url += "?confirm=" + deleteConfirm;
+  const res = await fetch(url, { method: "DELETE" });
+  if (res.status === 409) {
+    const data = await res.json();
+    deleteConfirm = data.confirm;
+    const warn = document.getElementById("deleteModalWarn");
+    warn.textContent = `This link has ${data.confirm} recorded clicks. Press Delete again to confirm.`;
+    warn.style.display = "";
+    return;
+  }
+  if (res.ok) {
+    const row = document.getElementById("row-" + currentDeleteCode);
+    // Later pages move up by one, unless the row was a search result
+    // from beyond the loaded pages.
+    const more = document.getElementById("loadMore");
+    if (more && !row.dataset.extra) more.dataset.offset--;
+    row.remove();
+    addToCount(-1);
+  }
   closeModal("modalDelete");
 }
+
+/* ── trash ── */
+async function openTrash() {
+  const list = document.getElementById("trashList");
+  list.replaceChildren();
+  openModal("modalTrash");
+  const res = await fetch("/trash");
+  if (!res.ok) return;
+  const links = await res.json();
+  document.getElementById("trashEmpty").style.display = links.length
+    ? "none"
+    : "";
+  for (const l of links) {
+    const tr = document.createElement("tr");
+    const info = document.createElement("td");
+    const code = document.createElement("code");
+    code.textContent = l.code;
+    const dest = document.createElement("div");
+    dest.className = "url-text";
+    dest.textContent = l.long_url;
+    const when = document.createElement("div");
+    when.className = "expires-text";
+    when.textContent = l.purge_at
+      ? `Purged after ${new Date(l.purge_at).toLocaleString()}`
+      : "Kept until purged";
+    info.append(code, dest, when);
+    const acts = document.createElement("td");
+    acts.className = "act-row";
+    const restore = document.createElement("button");
+    restore.className = "action-btn btn-save";
+    restore.textContent = "Restore";
+    restore.onclick = () => trashAction(l.code, "restore");
+    const purge = document.createElement("button");
+    purge.className = "action-btn btn-delete";
+    purge.textContent = "Delete forever";
+    purge.onclick = () => trashAction(l.code, "purge");
+    acts.append(restore, purge);
+    tr.append(info, acts);
+    list.append(tr);
+  }
+}
+
+async function trashAction(code, action) {
+  const res =
+    action === "restore"
+      ? await fetch(`/urls/${encodeURIComponent(code)}/restore`, {
+          method: "POST",
+        })
+      : await fetch(`/urls/${encodeURIComponent(code)}?purge=true`, {
+          method: "DELETE",
+        });
+  if (!res.ok) return;
+  // A restored link needs its table row back; the table is server-rendered.
+  if (action === "restore") location.reload();
+  else openTrash();
+}
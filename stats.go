@@ -0,0 +1,194 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Redirect outcomes recorded in the clicks table, one row per request that
+// reaches doRedirect. Anything other than outcomeRedirected is a hit that
+// did not (yet) reach the destination; a password link records its
+// outcomeRedirected when /pass/ unlocks it.
+const (
+	outcomeRedirected       = "redirected"
+	outcomeNotFound         = "not_found"
+	outcomeDisabled         = "disabled"
+	outcomeExpired          = "expired"
+	outcomeExhausted        = "exhausted"
+	outcomePasswordRequired = "password_required"
+	outcomeBadParams        = "bad_params" // query broke a template link's param_spec
+)
+
+// maxClickHeaderLen caps the referer and user agent stored per click.
+const maxClickHeaderLen = 512
+
+// recordClick logs a redirect attempt. Failures are logged and otherwise
+// ignored so analytics can never break a redirect.
+// Raw client addresses are never stored, only their hash.
+func recordClick(r *http.Request, code, outcome string) {
+	clip := func(v string) string {
+		if len(v) > maxClickHeaderLen {
+			return v[:maxClickHeaderLen]
+		}
+		return v
+	}
+	if _, err := db.Exec(
+		"INSERT INTO clicks (code, clicked_at, outcome, referer, user_agent, ip_hash) VALUES (?, ?, ?, ?, ?, ?)",
+		code, time.Now().UTC().Format(time.RFC3339), outcome,
+		clip(r.Referer()), clip(r.UserAgent()), hashPassword(clientIP(r)),
+	); err != nil {
+		log.Printf("record click %s: %v", code, err)
+		return
+	}
+	markChanged() // the list's clicks column
+}
+
+// outcomeCounts returns the number of recorded hits per outcome, either for a
+// single code or across all codes when code is "".
+func outcomeCounts(code string) (map[string]int, error) {
+	query := "SELECT outcome, COUNT(*) FROM clicks GROUP BY outcome"
+	var args []any
+	if code != "" {
+		query = "SELECT outcome, COUNT(*) FROM clicks WHERE code = ? GROUP BY outcome"
+		args = append(args, code)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var outcome string
+		var n int
+		if err := rows.Scan(&outcome, &n); err != nil {
+			return nil, err
+		}
+		counts[outcome] = n
+	}
+	return counts, rows.Err()
+}
+
+// redirectCount returns the number of recorded successful redirects for code.
+func redirectCount(code string) (int, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM clicks WHERE code = ? AND outcome = ?", code, outcomeRedirected).Scan(&n)
+	return n, err
+}
+
+// clickWindowDays is the length of the daily series in the stats response.
+const clickWindowDays = 30
+
+type dailyClicks struct {
+	Date   string `json:"date"` // YYYY-MM-DD, UTC
+	Clicks int    `json:"clicks"`
+}
+
+type clickSummary struct {
+	Total   int           `json:"total"`
+	Last24h int           `json:"last_24h"`
+	Last7d  int           `json:"last_7d"`
+	Last30d int           `json:"last_30d"`
+	Daily   []dailyClicks `json:"daily"` // last clickWindowDays days, oldest first
+}
+
+// clickStats summarizes successful redirects for code, or for every code
+// when code is "". Timestamps are RFC3339 UTC, so they compare as strings.
+func clickStats(code string) (clickSummary, error) {
+	now := time.Now().UTC()
+	today := now.Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, -(clickWindowDays - 1))
+
+	where, args := "outcome = ?", []any{outcomeRedirected}
+	if code != "" {
+		where, args = "code = ? AND outcome = ?", []any{code, outcomeRedirected}
+	}
+	var sum clickSummary
+	if err := db.QueryRow("SELECT COUNT(*) FROM clicks WHERE "+where, args...).Scan(&sum.Total); err != nil {
+		return sum, err
+	}
+	rows, err := db.Query("SELECT clicked_at FROM clicks WHERE "+where+" AND clicked_at >= ?",
+		append(args, now.AddDate(0, 0, -clickWindowDays).Format(time.RFC3339))...)
+	if err != nil {
+		return sum, err
+	}
+	defer rows.Close()
+
+	perDay := make([]int, clickWindowDays)
+	for rows.Next() {
+		var ts string
+		if err := rows.Scan(&ts); err != nil {
+			return sum, err
+		}
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			continue
+		}
+		age := now.Sub(t)
+		if age <= 24*time.Hour {
+			sum.Last24h++
+		}
+		if age <= 7*24*time.Hour {
+			sum.Last7d++
+		}
+		sum.Last30d++
+		if !t.Before(since) {
+			perDay[int(t.Sub(since)/(24*time.Hour))]++
+		}
+	}
+	for i, n := range perDay {
+		sum.Daily = append(sum.Daily, dailyClicks{Date: since.AddDate(0, 0, i).Format("2006-01-02"), Clicks: n})
+	}
+	return sum, rows.Err()
+}
+
+// statsHandler serves GET /stats (all links) and GET /stats/{code}: hits per
+// outcome, plus a clickSummary of the successful redirects.
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	code := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/stats"), "/")
+
+	counts, err := outcomeCounts(code)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if code != "" && total == 0 {
+		// Unknown codes with recorded not_found hits are still reported, so
+		// mistyped links can be diagnosed; only codes never seen at all 404.
+		if _, err := getRecord(code); err == sql.ErrNoRows {
+			jsonError(w, http.StatusNotFound, "not found")
+			return
+		} else if err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+	}
+
+	clicks, err := clickStats(code)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+
+	resp := map[string]any{
+		"total":    total,
+		"outcomes": counts,
+		"clicks":   clicks,
+	}
+	if code != "" {
+		resp["code"] = code
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const maxTagsPerLink = 10
+
+var validTag = regexp.MustCompile(`^[a-z0-9-]{1,24}$`)
+
+// tagList is stored in urls.tags as a comma-separated string ("a,b").
+// Filtering matches on ',' || tags || ',' so every tag is comma-delimited.
+type tagList []string
+
+func (t *tagList) Scan(src any) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("tags: unsupported type %T", src)
+	}
+	*t = tagList{}
+	if s != "" {
+		*t = strings.Split(s, ",")
+	}
+	return nil
+}
+
+func (t tagList) Value() (driver.Value, error) {
+	return strings.Join(t, ","), nil
+}
+
+// normalizeTags lowercases and trims tags, drops duplicates and validates
+// each one against validTag.
+func normalizeTags(in []string) (tagList, error) {
+	out := tagList{}
+	for _, raw := range in {
+		tag := strings.ToLower(strings.TrimSpace(raw))
+		if !validTag.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag %q: use 1–24 letters, numbers or hyphens", raw)
+		}
+		if !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	return out, nil
+}
+
+// linkTags normalizes the full tag set given for one link and enforces
+// maxTagsPerLink.
+func linkTags(in []string) (tagList, error) {
+	tags, err := normalizeTags(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) > maxTagsPerLink {
+		return nil, fmt.Errorf("at most %d tags per link", maxTagsPerLink)
+	}
+	return tags, nil
+}
+
+// applyTags returns cur with add appended and remove taken out, preserving order.
+func applyTags(cur, add, remove tagList) tagList {
+	out := tagList{}
+	for _, tag := range append(slices.Clone(cur), add...) {
+		if !slices.Contains(remove, tag) && !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+type tagResult struct {
+	Code  string  `json:"code"`
+	Tags  tagList `json:"tags"`
+	Error string  `json:"error,omitempty"`
+}
+
+// tagBulkHandler serves POST /urls/tag: add and/or remove tags on many links
+// in one transaction. Unknown codes and links that would exceed
+// maxTagsPerLink are reported per code and left untouched. At most batchMax
+// codes per request, as for POST /urls/batch.
+func tagBulkHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Codes  []string `json:"codes"`
+		Add    []string `json:"add"`
+		Remove []string `json:"remove"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBytes)).Decode(&body); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if len(body.Codes) == 0 || len(body.Add)+len(body.Remove) == 0 {
+		jsonError(w, http.StatusBadRequest, "codes and at least one of add/remove are required")
+		return
+	}
+	if len(body.Codes) > batchMax {
+		jsonError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d codes per request", batchMax))
+		return
+	}
+	add, err := normalizeTags(body.Add)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	remove, err := normalizeTags(body.Remove)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	defer tx.Rollback()
+
+	results := make([]tagResult, 0, len(body.Codes))
+	changed := false
+	for _, code := range body.Codes {
+		var cur tagList
+		err := tx.QueryRow("SELECT tags FROM urls WHERE code = ? AND "+liveLink, code).Scan(&cur)
+		if err == sql.ErrNoRows {
+			results = append(results, tagResult{Code: code, Error: "not found"})
+			continue
+		} else if err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		next := applyTags(cur, add, remove)
+		if len(next) > maxTagsPerLink {
+			results = append(results, tagResult{Code: code, Tags: cur, Error: fmt.Sprintf("at most %d tags per link", maxTagsPerLink)})
+			continue
+		}
+		if _, err := tx.Exec("UPDATE urls SET tags = ? WHERE code = ?", next, code); err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		changed = true
+		results = append(results, tagResult{Code: code, Tags: next})
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	if changed {
+		markChanged()
+	}
+
+	writeJSON(w, r, http.StatusOK, map[string]any{"results": results})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	// The release image is FROM scratch, with no zoneinfo to load from.
+	_ "time/tzdata"
+)
+
+// Timestamps are stored as RFC3339 in UTC. Rows written before v27 (v31 for
+// last_accessed_at, tokens and audit_log) used "2006-01-02 15:04:05" (also
+// UTC); the migrations rewrite them, and
+// parseStoredTime still reads that form for anything it missed and for old
+// exports being imported.
+func parseStoredTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateTime, s)
+}
+
+// storedTime returns s as RFC3339 UTC, or unchanged if it is not a time.
+func storedTime(s string) string {
+	t, err := parseStoredTime(s)
+	if err != nil {
+		return s
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+const displayTimeLayout = "2006-01-02 15:04 MST"
+
+// displayTime formats a stored or RFC3339 time for people in loc.
+func displayTime(s string, loc *time.Location) string {
+	if s == "" {
+		return ""
+	}
+	t, err := parseStoredTime(s)
+	if err != nil {
+		return s
+	}
+	return t.In(loc).Format(displayTimeLayout)
+}
+
+// locations caches time.LoadLocation, which parses tzdata on every call.
+var locations sync.Map
+
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// displayLocation is the timezone setting, or UTC when it is unset.
+func displayLocation() *time.Location {
+	loc, err := loadLocation(cfg.setting("timezone"))
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// requestLocation is the ?tz= zone when given, else displayLocation.
+func requestLocation(r *http.Request) (*time.Location, error) {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		return displayLocation(), nil
+	}
+	loc, err := loadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("tz %q is not an IANA time zone such as Europe/Berlin", name)
+	}
+	return loc, nil
+}
+
+// localize fills the display strings for created_at, expires_at and
+// last_accessed_at in loc.
+func (r *URLRow) localize(loc *time.Location) {
+	r.CreatedDisplay = displayTime(r.CreatedAt, loc)
+	r.ExpiresDisplay = displayTime(r.ExpiresAt, loc)
+	r.AccessedDisplay = displayTime(r.LastAccessedAt, loc)
+}
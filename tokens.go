@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// API tokens let scripts use the link endpoints without a session cookie or
+// the admin password: send "Authorization: Bearer <token>". Tokens are
+// created, listed and revoked by an admin at /tokens; the plaintext is only
+// returned on creation and only its sha256 is stored. A token grants the
+// same access as the admin login, but only on apiTokenRoute paths.
+const (
+	apiTokenPrefix = "gourl_"
+	maxTokenLabel  = 100
+)
+
+type apiToken struct {
+	ID        string `json:"id"`
+	Label     string `json:"label"`
+	CreatedAt string `json:"created_at"`
+	LastUsed  string `json:"last_used"` // empty if never used
+	Token     string `json:"token,omitempty"`
+}
+
+// apiTokenRoute reports whether r's path accepts an API token: link
+// creation and management, bulk creation and import.
+func apiTokenRoute(r *http.Request) bool {
+	p := r.URL.Path
+	return p == "/shorten" || p == "/shorten/bulk" || p == "/urls" || strings.HasPrefix(p, "/urls/") || p == "/import"
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerToken returns the token from r's Authorization header, if any.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// validAPIToken looks token up by its hash and stamps last_used. The stamp
+// is best-effort: a failure is logged and the request goes ahead.
+func validAPIToken(token string) bool {
+	hash := hashAPIToken(token)
+	var id string
+	err := db.QueryRow("SELECT id FROM tokens WHERE token_hash = ?", hash).Scan(&id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("api token lookup: %v", err)
+		}
+		return false
+	}
+	if _, err := db.Exec("UPDATE tokens SET last_used = ? WHERE id = ?", time.Now().UTC().Format(time.RFC3339), id); err != nil {
+		log.Printf("api token %s last_used: %v", id, err)
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func listAPITokens() ([]apiToken, error) {
+	rows, err := db.Query("SELECT id, label, created_at, last_used FROM tokens ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []apiToken{}
+	for rows.Next() {
+		var t apiToken
+		if err := rows.Scan(&t.ID, &t.Label, &t.CreatedAt, &t.LastUsed); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// tokensHandler serves GET /tokens (list), POST /tokens ({"label": "..."},
+// returns the new token once) and DELETE /tokens/{id} (revoke).
+func tokensHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/tokens"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		tokens, err := listAPITokens()
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, tokens)
+
+	case id == "" && r.Method == http.MethodPost:
+		var body struct {
+			Label string `json:"label"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+		label := strings.TrimSpace(body.Label)
+		if utf8.RuneCountInString(label) > maxTokenLabel {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("label is longer than %d characters", maxTokenLabel))
+			return
+		}
+		t := apiToken{
+			ID:        randomHex(8),
+			Label:     label,
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+			Token:     apiTokenPrefix + randomHex(32),
+		}
+		if _, err := db.Exec(
+			"INSERT INTO tokens (id, token_hash, label, created_at) VALUES (?, ?, ?, ?)",
+			t.ID, hashAPIToken(t.Token), t.Label, t.CreatedAt,
+		); err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		log.Printf("api token %s (%q) created by %s", t.ID, t.Label, clientIP(r))
+		writeJSON(w, r, http.StatusCreated, t)
+
+	case id != "" && r.Method == http.MethodDelete:
+		res, err := db.Exec("DELETE FROM tokens WHERE id = ?", id)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "database error")
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			jsonError(w, http.StatusNotFound, "token not found")
+			return
+		}
+		log.Printf("api token %s revoked by %s", id, clientIP(r))
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
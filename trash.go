@@ -0,0 +1,128 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+)
+
+// Deleting a link moves it to the trash: deleted_at is stamped and every
+// lookup that filters on liveLink (redirects, the list, exports …) stops
+// seeing it, but the code stays taken and its clicks are kept. POST
+// /urls/{code}/restore brings it back; DELETE /urls/{code}?purge=true, or
+// the cleanup job once trashRetention has passed, removes it for good.
+const liveLink = "deleted_at = ''"
+
+type trashEntry struct {
+	linkView
+	PurgeAt string `json:"purge_at,omitempty"` // when cleanup removes it; empty if never
+}
+
+// getTrashedURLs returns the links in the trash, most recently deleted first.
+func getTrashedURLs() ([]URLRow, error) {
+	return queryURLs("SELECT " + rowColumns + " FROM urls WHERE deleted_at != '' ORDER BY deleted_at DESC, code")
+}
+
+// restoreURL takes a link out of the trash.
+func restoreURL(code string) error {
+	res, err := db.Exec("UPDATE urls SET deleted_at = '' WHERE code = ? AND deleted_at != ''", code)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	markChanged()
+	forgetRecord(code)
+	return nil
+}
+
+// purgeTrash removes links deleted more than trashRetention ago and returns
+// how many went. deleted_at is RFC3339 UTC, so the cutoff compares as text.
+func purgeTrash() (int, error) {
+	if trashRetention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-trashRetention).UTC().Format(time.RFC3339)
+	rows, err := db.Query("SELECT code FROM urls WHERE deleted_at != '' AND deleted_at < ?", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		codes = append(codes, code)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, code := range codes {
+		image, err := purgeURL(code)
+		if err == sql.ErrNoRows {
+			continue // restored or purged in the meantime
+		} else if err != nil {
+			return purged, err
+		}
+		logAuditBestEffort(code, auditPurge, "", "", "cleanup")
+		removeOGImageFile(image)
+		purged++
+	}
+	return purged, nil
+}
+
+// trashHandler serves GET /trash: the deleted links, newest deletion first,
+// each with the time cleanup will purge it.
+func trashHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	loc, err := requestLocation(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	urls, err := getTrashedURLs()
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	entries := make([]trashEntry, len(urls))
+	for i, u := range urls {
+		u.localize(loc)
+		entries[i] = trashEntry{linkView: linkJSON(u)}
+		if t, err := time.Parse(time.RFC3339, u.DeletedAt); err == nil && trashRetention > 0 {
+			entries[i].PurgeAt = t.Add(trashRetention).UTC().Format(time.RFC3339)
+		}
+	}
+	writeJSON(w, r, http.StatusOK, entries)
+}
+
+// urlsRestoreHandler serves POST /urls/{code}/restore and returns the
+// restored link like GET /urls/{code}.
+func urlsRestoreHandler(w http.ResponseWriter, r *http.Request, code string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := restoreURL(code); err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, "not in the trash")
+		return
+	} else if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	logAuditBestEffort(code, auditRestore, "", "", clientIP(r))
+	row, err := getURLRow(code)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "database error")
+		return
+	}
+	writeJSON(w, r, http.StatusOK, linkJSON(row))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// utmKeys are the campaign parameters a link can add to its destination.
+var utmKeys = [...]string{"utm_source", "utm_medium", "utm_campaign"}
+
+// utmValues returns the link's UTM fields in utmKeys order.
+func (r urlRecord) utmValues() [len(utmKeys)]string {
+	return [...]string{r.UTMSource, r.UTMMedium, r.UTMCampaign}
+}
+
+// appendUTM adds the non-empty UTM values to longURL's query string, skipping
+// keys the URL already has, so a hand-tagged destination always wins. The
+// rest of the URL, including a #fragment, is left exactly as stored.
+func appendUTM(longURL string, values [len(utmKeys)]string) string {
+	u, err := url.Parse(longURL)
+	if err != nil {
+		return longURL
+	}
+	have := u.Query()
+	add := url.Values{}
+	for i, k := range utmKeys {
+		if values[i] != "" && !have.Has(k) {
+			add.Set(k, values[i])
+		}
+	}
+	if len(add) == 0 {
+		return longURL
+	}
+	base, frag, hasFrag := strings.Cut(longURL, "#")
+	switch {
+	case !strings.Contains(base, "?"):
+		base += "?"
+	case !strings.HasSuffix(base, "?") && !strings.HasSuffix(base, "&"):
+		base += "&"
+	}
+	base += add.Encode()
+	if hasFrag {
+		base += "#" + frag
+	}
+	return base
+}
+
+// checkUTM trims the UTM values and checks their length.
+func checkUTM(values ...*string) error {
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		*v = strings.TrimSpace(*v)
+		if utf8.RuneCountInString(*v) > maxUTMLen {
+			return fmt.Errorf("%s is longer than %d characters", utmKeys[i], maxUTMLen)
+		}
+	}
+	return nil
+}
+
+// destination is where the link sends visitors: long_url with its UTM
+// parameters, escaped for a Location header or HTML attribute.
+func (r urlRecord) destination() string {
+	return escapeDestination(appendUTM(r.LongURL, r.utmValues()))
+}